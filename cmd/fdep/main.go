@@ -0,0 +1,408 @@
+// Command fdep loads a proto tree and prints what fdep resolves from it.
+//
+// Usage:
+//
+//	fdep [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	files                  list all files with their type and package
+//	packages               list all packages with their files
+//	types [package]        list all messages, enums and services
+//	extensions             list all extended types with the extending packages
+//	options                list all custom options declared by extend blocks
+//	resolve <file> <name>  resolve a type name in the context of a file
+//	dump                   dump the full resolved model as JSON
+//
+// Example:
+//
+//	fdep -I /protoc/include -r app=proto/app -json types app.core
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/RangelReale/fdep"
+	"github.com/RangelReale/fproto"
+)
+
+// A repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "fdep: %v\n", err)
+	}
+	os.Exit(exitCode(err))
+}
+
+// Returns the exit code for the result of run: 2 for usage errors, 1 for other errors.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 2
+	default:
+		return 1
+	}
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	var include_dirs, roots stringList
+
+	flags := flag.NewFlagSet("fdep", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Var(&include_dirs, "I", "include `directory`, can be repeated")
+	flags.Var(&roots, "r", "own files `[root=]directory`, can be repeated")
+	as_json := flags.Bool("json", false, "output as JSON")
+	ignore_missing := flags.Bool("ignore-missing", false, "ignore imports that are not found")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: fdep [flags] files|packages|types [package]|extensions|options|resolve <file> <name>|dump\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	dep := fdep.NewDep()
+	dep.IgnoreNotFoundDependencies = *ignore_missing
+
+	for _, inc := range include_dirs {
+		if err := dep.AddIncludeDir(inc); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range roots {
+		var err error
+		if i := strings.Index(r, "="); i >= 0 {
+			err = dep.AddPathWithRoot(r[:i], r[i+1:], fdep.DepType_Own)
+		} else {
+			err = dep.AddPath(r, fdep.DepType_Own)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	out := &output{w: stdout, json: *as_json}
+
+	cmd, cmd_args := flags.Arg(0), flags.Args()[1:]
+	switch cmd {
+	case "files":
+		return cmdFiles(dep, out)
+	case "packages":
+		return cmdPackages(dep, out)
+	case "types":
+		if len(cmd_args) > 1 {
+			return fmt.Errorf("usage: fdep types [package]")
+		}
+		pkg := ""
+		if len(cmd_args) == 1 {
+			pkg = cmd_args[0]
+		}
+		return cmdTypes(dep, out, pkg)
+	case "extensions":
+		return cmdExtensions(dep, out)
+	case "options":
+		return cmdOptions(dep, out)
+	case "resolve":
+		if len(cmd_args) != 2 {
+			return fmt.Errorf("usage: fdep resolve <file> <name>")
+		}
+		return cmdResolve(dep, out, cmd_args[0], cmd_args[1])
+	case "dump":
+		return dep.WriteJSONDump(stdout)
+	default:
+		return fmt.Errorf("Unknown command '%s'", cmd)
+	}
+}
+
+// Writes either text lines or a single JSON value.
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+func (o *output) line(format string, args ...interface{}) {
+	fmt.Fprintf(o.w, format+"\n", args...)
+}
+
+func (o *output) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(o.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type fileInfo struct {
+	Path         string   `json:"path"`
+	Type         string   `json:"type"`
+	Package      string   `json:"package"`
+	NotFound     bool     `json:"not_found,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+func cmdFiles(dep *fdep.Dep, out *output) error {
+	ret := []fileInfo{}
+	for _, df := range dep.GetFiles() {
+		fi := fileInfo{
+			Path:     df.FilePath,
+			Type:     df.DepType.String(),
+			NotFound: df.NotFound,
+		}
+		if df.ProtoFile != nil {
+			fi.Package = df.ProtoFile.PackageName
+			fi.Dependencies = df.ProtoFile.Dependencies
+		}
+		ret = append(ret, fi)
+	}
+
+	if out.json {
+		return out.writeJSON(ret)
+	}
+	for _, fi := range ret {
+		if fi.NotFound {
+			out.line("%s (%s) [not found]", fi.Path, fi.Type)
+		} else {
+			out.line("%s (%s) [package: %s]", fi.Path, fi.Type, fi.Package)
+		}
+	}
+	return nil
+}
+
+type packageInfo struct {
+	Name  string   `json:"name"`
+	Files []string `json:"files"`
+}
+
+func cmdPackages(dep *fdep.Dep, out *output) error {
+	ret := []packageInfo{}
+	for _, pkg := range dep.GetPackages() {
+		ret = append(ret, packageInfo{
+			Name:  pkg,
+			Files: dep.GetPackageFiles(pkg),
+		})
+	}
+
+	if out.json {
+		return out.writeJSON(ret)
+	}
+	for _, pi := range ret {
+		out.line("%s [files: %s]", pi.Name, strings.Join(pi.Files, ", "))
+	}
+	return nil
+}
+
+type typeInfo struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	File     string `json:"file,omitempty"`
+	FileType string `json:"file_type,omitempty"`
+	Alias    string `json:"alias,omitempty"`
+}
+
+func newTypeInfo(t *fdep.DepType) typeInfo {
+	if t.IsScalar() {
+		return typeInfo{
+			Name: t.ScalarType.ProtoType(),
+			Kind: "SCALAR",
+		}
+	}
+	return typeInfo{
+		Name:     t.FullOriginalName(),
+		Kind:     t.Item.ElementTypeName(),
+		File:     t.DepFile.FilePath,
+		FileType: t.DepFile.DepType.String(),
+		Alias:    t.Alias,
+	}
+}
+
+func (ti typeInfo) String() string {
+	if ti.File == "" {
+		return fmt.Sprintf("%s %s", ti.Kind, ti.Name)
+	}
+	return fmt.Sprintf("%s %s [file: %s]", ti.Kind, ti.Name, ti.File)
+}
+
+func cmdTypes(dep *fdep.Dep, out *output, pkg string) error {
+	filter := fdep.TypeFilter{Kinds: fdep.TypeKind_Message | fdep.TypeKind_Enum | fdep.TypeKind_Service}
+
+	var types []*fdep.DepType
+	if pkg != "" {
+		types = dep.PackageTypes(pkg, filter)
+	} else {
+		types = dep.AllTypes(filter)
+	}
+
+	ret := []typeInfo{}
+	for _, t := range types {
+		ret = append(ret, newTypeInfo(t))
+	}
+
+	if out.json {
+		return out.writeJSON(ret)
+	}
+	for _, ti := range ret {
+		out.line("%s", ti)
+	}
+	return nil
+}
+
+type extensionInfo struct {
+	Name     string   `json:"name"`
+	Packages []string `json:"packages"`
+}
+
+func cmdExtensions(dep *fdep.Dep, out *output) error {
+	ret := []extensionInfo{}
+	for name, pkgs := range dep.Extensions {
+		pkgs = append([]string(nil), pkgs...)
+		sort.Strings(pkgs)
+		ret = append(ret, extensionInfo{
+			Name:     name,
+			Packages: pkgs,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	if out.json {
+		return out.writeJSON(ret)
+	}
+	for _, ei := range ret {
+		out.line("%s [packages: %s]", ei.Name, strings.Join(ei.Packages, ", "))
+	}
+	return nil
+}
+
+type optionInfo struct {
+	Item string `json:"item"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	File string `json:"file"`
+}
+
+func cmdOptions(dep *fdep.Dep, out *output) error {
+	items := make(map[string]fdep.OptionItem)
+	for _, oi := range fdep.OptionItem_All {
+		items[oi.MessageName()] = oi
+	}
+
+	ret := []optionInfo{}
+	for _, df := range dep.GetFiles() {
+		if df.ProtoFile == nil {
+			continue
+		}
+		for _, em := range df.ProtoFile.CollectExtendMessages() {
+			m, ok := em.(*fproto.MessageElement)
+			if !ok || !m.IsExtend {
+				continue
+			}
+
+			// only the extended type is resolved, so files with missing imports can be listed.
+			// Extend blocks declared in messages are resolved and scoped in the message.
+			scope := df.ProtoFile.PackageName
+			var extended *fdep.DepType
+			var err error
+			if parent, ok := m.ParentElement().(*fproto.MessageElement); ok {
+				pt := dep.DepTypeFromElement(parent)
+				scope = pt.FullOriginalName()
+				extended, err = pt.FindType(m.Name)
+			} else {
+				extended, err = df.FindType(m.Name)
+			}
+			if err != nil {
+				return err
+			}
+			if extended == nil {
+				// not found, so it is not an option message
+				continue
+			}
+
+			oi, ok := items[extended.FullOriginalName()]
+			if !ok {
+				continue
+			}
+			for _, fld := range m.Fields {
+				xfld, ok := fld.(*fproto.FieldElement)
+				if !ok {
+					continue
+				}
+				name := xfld.Name
+				if scope != "" {
+					name = scope + "." + name
+				}
+				ret = append(ret, optionInfo{
+					Item: optionItemName(oi),
+					Name: name,
+					Type: xfld.Type,
+					File: df.FilePath,
+				})
+			}
+		}
+	}
+
+	if out.json {
+		return out.writeJSON(ret)
+	}
+	for _, oi := range ret {
+		out.line("%s (%s) %s [file: %s]", oi.Item, oi.Name, oi.Type, oi.File)
+	}
+	return nil
+}
+
+func optionItemName(oi fdep.OptionItem) string {
+	return strings.TrimSuffix(strings.TrimPrefix(oi.MessageName(), "google.protobuf."), "Options")
+}
+
+func cmdResolve(dep *fdep.Dep, out *output, filepath string, name string) error {
+	df := dep.GetFile(filepath)
+	if df == nil {
+		return fmt.Errorf("File %s not found", filepath)
+	}
+
+	types, err := df.GetTypes(name)
+	if err != nil {
+		return err
+	}
+	if len(types) == 0 {
+		return fmt.Errorf("Type '%s' not found in the context of file %s", name, filepath)
+	}
+
+	ret := []typeInfo{}
+	for _, t := range types {
+		ret = append(ret, newTypeInfo(t))
+	}
+
+	if out.json {
+		return out.writeJSON(ret)
+	}
+	for _, ti := range ret {
+		out.line("%s", ti)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testFiles = map[string]string{
+	"include/google/protobuf/descriptor.proto": `
+syntax = "proto2";
+package google.protobuf;
+
+message FieldOptions {
+	extensions 1000 to max;
+}
+`,
+	"proto/p_user/user.proto": `
+syntax = "proto3";
+package p_user;
+
+import "p_base/base.proto";
+
+message User {
+	string name = 1;
+	p_base.Status status = 2;
+}
+
+service UserService {
+	rpc Get(User) returns (User);
+}
+`,
+	"proto/p_base/base.proto": `
+syntax = "proto3";
+package p_base;
+
+enum Status {
+	ACTIVE = 0;
+	INACTIVE = 1;
+}
+`,
+	"proto/p_option/option.proto": `
+syntax = "proto2";
+package p_option;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.FieldOptions {
+	optional string jsontag = 50000;
+}
+
+message Outer {
+	extend google.protobuf.FieldOptions {
+		optional int32 weight = 50001;
+	}
+}
+`,
+}
+
+// Writes the test files to a temporary directory, and returns its path.
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Runs the command on the test files, and returns its output.
+func runTest(t *testing.T, args ...string) string {
+	t.Helper()
+
+	dir := writeTestFiles(t, testFiles)
+	args = append([]string{"-I", filepath.Join(dir, "include"), "-r", filepath.Join(dir, "proto")}, args...)
+
+	var stdout, stderr bytes.Buffer
+	if err := run(args, &stdout, &stderr); err != nil {
+		t.Fatalf("Error running fdep %s: %v", strings.Join(args, " "), err)
+	}
+	return stdout.String()
+}
+
+func TestFiles(t *testing.T) {
+	expected := `google/protobuf/descriptor.proto (IMPORTED) [package: google.protobuf]
+p_base/base.proto (OWN) [package: p_base]
+p_option/option.proto (OWN) [package: p_option]
+p_user/user.proto (OWN) [package: p_user]
+`
+	if out := runTest(t, "files"); out != expected {
+		t.Fatalf("Unexpected files output:\n%s", out)
+	}
+
+	var files []fileInfo
+	if err := json.Unmarshal([]byte(runTest(t, "-json", "files")), &files); err != nil {
+		t.Fatalf("Error decoding JSON output: %v", err)
+	}
+	if len(files) != 4 || files[3].Path != "p_user/user.proto" || files[3].Type != "OWN" ||
+		files[3].Package != "p_user" || strings.Join(files[3].Dependencies, ",") != "p_base/base.proto" {
+		t.Fatalf("Unexpected files JSON output: %+v", files)
+	}
+}
+
+func TestTypes(t *testing.T) {
+	expected := `MESSAGE google.protobuf.FieldOptions [file: google/protobuf/descriptor.proto]
+ENUM p_base.Status [file: p_base/base.proto]
+MESSAGE p_option.Outer [file: p_option/option.proto]
+MESSAGE p_user.User [file: p_user/user.proto]
+SERVICE p_user.UserService [file: p_user/user.proto]
+`
+	if out := runTest(t, "types"); out != expected {
+		t.Fatalf("Unexpected types output:\n%s", out)
+	}
+
+	var types []typeInfo
+	if err := json.Unmarshal([]byte(runTest(t, "-json", "types", "p_user")), &types); err != nil {
+		t.Fatalf("Error decoding JSON output: %v", err)
+	}
+	if len(types) != 2 || types[0] != (typeInfo{Name: "p_user.User", Kind: "MESSAGE", File: "p_user/user.proto", FileType: "OWN", Alias: "p_user"}) ||
+		types[1].Name != "p_user.UserService" || types[1].Kind != "SERVICE" {
+		t.Fatalf("Unexpected types JSON output: %+v", types)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	if out := runTest(t, "resolve", "p_user/user.proto", "p_base.Status"); out != "ENUM p_base.Status [file: p_base/base.proto]\n" {
+		t.Fatalf("Unexpected resolve output:\n%s", out)
+	}
+
+	var types []typeInfo
+	if err := json.Unmarshal([]byte(runTest(t, "-json", "resolve", "p_user/user.proto", "string")), &types); err != nil {
+		t.Fatalf("Error decoding JSON output: %v", err)
+	}
+	if len(types) != 1 || types[0] != (typeInfo{Name: "string", Kind: "SCALAR"}) {
+		t.Fatalf("Unexpected resolve JSON output: %+v", types)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	// the options declared on extend blocks nested in messages are scoped in the message
+	expected := `Field (p_option.jsontag) string [file: p_option/option.proto]
+Field (p_option.Outer.weight) int32 [file: p_option/option.proto]
+`
+	if out := runTest(t, "options"); out != expected {
+		t.Fatalf("Unexpected options output:\n%s", out)
+	}
+}
+
+func TestOptionsIgnoreMissing(t *testing.T) {
+	// only the extended types are resolved, so field types from missing imports don't fail
+	dir := writeTestFiles(t, map[string]string{
+		"include/google/protobuf/descriptor.proto": testFiles["include/google/protobuf/descriptor.proto"],
+		"proto/p_option/option.proto": `
+syntax = "proto2";
+package p_option;
+
+import "google/protobuf/descriptor.proto";
+import "p_missing/missing.proto";
+
+extend google.protobuf.FieldOptions {
+	optional string jsontag = 50000;
+}
+
+message Data {
+	optional p_missing.Missing missing = 1;
+}
+`,
+	})
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-ignore-missing", "-I", filepath.Join(dir, "include"), "-r", filepath.Join(dir, "proto"), "options"}
+	if err := run(args, &stdout, &stderr); err != nil {
+		t.Fatalf("Error running fdep %s: %v", strings.Join(args, " "), err)
+	}
+	if out := stdout.String(); out != "Field (p_option.jsontag) string [file: p_option/option.proto]\n" {
+		t.Fatalf("Unexpected options output:\n%s", out)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"p_a/a.proto": `
+syntax = "proto3";
+package p_a;
+
+import "p_missing/missing.proto";
+`,
+	})
+
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-r", dir, "files"}, &stdout, &stderr)
+	if err == nil || exitCode(err) != 1 {
+		t.Fatalf("A missing import should exit with code 1, but got %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Fatalf("Nothing should be written on a load error, got:\n%s", stdout.String())
+	}
+
+	if err := run([]string{"-ignore-missing", "-r", dir, "files"}, &stdout, &stderr); exitCode(err) != 0 {
+		t.Fatalf("A missing import should be ignored, but got %v", err)
+	}
+
+	if err := run(nil, &stdout, &stderr); exitCode(err) != 2 {
+		t.Fatalf("Running without a command should exit with code 2, but got %v", err)
+	}
+}
@@ -1,18 +1,26 @@
 package fdep
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path"
 	gofilepath "path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/RangelReale/fproto"
 )
 
 // Dep represents an .proto file hierarchy with dependencies between files.
+//
+// All methods are safe for concurrent use, including adding files while other goroutines
+// are looking up types. The exported maps must not be accessed directly while files may
+// be added concurrently, use the accessor methods (GetFile, GetFiles, GetPackages, etc) instead.
 type Dep struct {
 	// List of files parsed. The file names are the INTERNAL name, like "google/protobuf/empty.proto".
 	Files map[string]*DepFile
@@ -27,8 +35,86 @@ type Dep struct {
 	// Directories to look for unknown includes
 	IncludeDirs []string
 
+	// Directories inside filesystems to look for unknown includes.
+	// They are searched after IncludeDirs.
+	IncludeDirsFS []IncludeDirFS
+
 	// File paths to ignore. This actually checks a prefix of the file name.
 	IgnoreFilePaths []string
+
+	// If false (the default), an import that is not found in any include directory
+	// makes AddReader fail with a *DependencyNotFoundError, and the file is not added.
+	// If true, the file is added as a stub DepFile with NotFound set and a nil ProtoFile,
+	// and can be checked later using CheckDependencies.
+	//
+	// Before this field existed, missing imports were always added as stubs, so code that
+	// relies on that must set it to true.
+	IgnoreNotFoundDependencies bool
+
+	// If true, the AddPath functions, AddReader and AddFileProvider don't stop on the first error.
+	// Loading continues, and all errors found are returned, in a *MultiError if there is more
+	// than one. The files loaded successfully are kept and can be used normally, and a file
+	// whose imports can't be loaded is not added.
+	ContinueOnError bool
+
+	// Number of goroutines used by the AddPath functions to parse files in parallel.
+	// If less than 2, files are parsed one at a time. The files are always added to the
+	// dependency in the same order, so the result is the same regardless of this value.
+	ParseWorkers int
+
+	// Cache of parsed files, keyed by the content hash and the layout of the fproto types.
+	// If nil, files are always parsed. The cache never makes adding a file fail: errors
+	// storing files on it are ignored, and it is not used if the fproto types can't be stored.
+	ParseCache ParseCache
+
+	// Directories added using the AddPath functions, used by the Watcher.
+	roots []pathRoot
+
+	// Files being added by the AddPath functions, by internal path, so the imports among
+	// them use the parse results of the workers instead of parsing the files again.
+	pathFiles map[string]*pathFile
+
+	// Reverse dependency index: for each imported file, the files that import it,
+	// and whether it is a public import.
+	importedBy map[string]map[string]bool
+
+	// Symbol index: the canonical types by fully-qualified name, and by element.
+	symbols     map[string][]*DepType
+	symbolItems map[fproto.FProtoElement]*DepType
+
+	// Incremented each time the list of files changes, to invalidate the caches.
+	generation int
+
+	// The files changed by the file being added, to roll them back if it fails.
+	changes *fileChanges
+
+	// Type reference index, valid while typeReferencesGeneration is equal to generation.
+	typeReferences           map[interface{}][]*TypeReference
+	typeReferencesGeneration int
+
+	// Resolved fields by message element, valid while fieldsGeneration is equal to
+	// generation. See DepType.Fields.
+	fields           map[fproto.FProtoElement][]*DepField
+	fieldsGeneration int
+
+	// Protects the files, the include dirs and the indexes. The unexported methods
+	// expect the lock to be already held by the caller, unless noted.
+	mu sync.RWMutex
+
+	// Protects the type reference index. Must be acquired before mu.
+	refsMu sync.Mutex
+
+	// Protects the resolved fields cache. No other lock is acquired while holding it.
+	fieldsMu sync.Mutex
+}
+
+// An include directory inside a filesystem.
+type IncludeDirFS struct {
+	// The filesystem
+	FS fs.FS
+
+	// The directory inside the filesystem, use "." for the root.
+	Dir string
 }
 
 // Creates a new Dep struct.
@@ -48,13 +134,34 @@ func (d *Dep) AddIncludeDir(dir string) error {
 		return fmt.Errorf("Path %s isn't a directory", dir)
 	}
 
+	d.mu.Lock()
 	d.IncludeDirs = append(d.IncludeDirs, dir)
+	d.mu.Unlock()
+
+	return nil
+}
+
+// Add one include dir inside a filesystem to be searched for an unknown import.
+// Ex: dep.AddIncludeDirFS(embeddedFS, "include")
+func (d *Dep) AddIncludeDirFS(fsys fs.FS, dir string) error {
+	if s, err := fs.Stat(fsys, dir); err != nil {
+		return fmt.Errorf("Invalid directory %s: %v", dir, err)
+	} else if !s.IsDir() {
+		return fmt.Errorf("Path %s isn't a directory", dir)
+	}
+
+	d.mu.Lock()
+	d.IncludeDirsFS = append(d.IncludeDirsFS, IncludeDirFS{FS: fsys, Dir: dir})
+	d.mu.Unlock()
 
 	return nil
 }
 
 // Returns a DepFile given a ProtoFile
 func (d *Dep) DepFileFromProtofile(pfile *fproto.ProtoFile) *DepFile {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	for _, df := range d.Files {
 		if df.ProtoFile == pfile {
 			return df
@@ -72,8 +179,57 @@ func (d *Dep) DepFileFromElement(element fproto.FProtoElement) *DepFile {
 	return nil
 }
 
-// Returns a DepType given an fproto element
+// Returns the file with the passed INTERNAL path, or nil if not found.
+func (d *Dep) GetFile(filepath string) *DepFile {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.Files[filepath]
+}
+
+// Returns all files, sorted by path.
+func (d *Dep) GetFiles() []*DepFile {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var ret []*DepFile
+	for _, filepath := range d.sortedFilePaths() {
+		ret = append(ret, d.Files[filepath])
+	}
+	return ret
+}
+
+// Returns the names of all packages, sorted.
+func (d *Dep) GetPackages() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var ret []string
+	for pkg := range d.Packages {
+		ret = append(ret, pkg)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Returns the paths of the files of a package.
+func (d *Dep) GetPackageFiles(pkg string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]string(nil), d.Packages[pkg]...)
+}
+
+// Returns a DepType given an fproto element.
+// For messages, enums and services, the canonical type from the symbol index is returned.
 func (d *Dep) DepTypeFromElement(element fproto.FProtoElement) *DepType {
+	d.mu.RLock()
+	t, ok := d.symbolItems[element]
+	d.mu.RUnlock()
+	if ok {
+		return t
+	}
+
 	fd := d.DepFileFromElement(element)
 	if fd != nil {
 		return NewDepTypeFromElement(fd, element)
@@ -96,42 +252,44 @@ func (d *Dep) AddPath(dir string, deptype DepFileType) error {
 // 		dep.AddPath("/protoc-3.5.1/include", fdep.DepType_Imported)
 // 		dep.AddPathWithRoot("google", "/protoc-3.5.1/include/google", fdep.DepType_Imported)
 func (d *Dep) AddPathWithRoot(currentpath, dir string, deptype DepFileType) error {
-	files, err := ioutil.ReadDir(dir)
-	if err != nil {
+	if _, err := os.Stat(dir); err != nil {
 		return err
 	}
 
-	for _, f := range files {
-		if f.IsDir() {
-			err = d.AddPathWithRoot(path.Join(currentpath, f.Name()), gofilepath.Join(dir, f.Name()), deptype)
-		} else {
-			if gofilepath.Ext(f.Name()) == ".proto" {
-				err = d.AddFile(currentpath, gofilepath.Join(dir, f.Name()), deptype)
-			} else {
-				err = nil
-			}
-		}
-		if err != nil {
-			return err
-		}
-	}
+	return d.AddPathWithRootFS(currentpath, os.DirFS(dir), ".", deptype)
+}
 
-	return nil
+// Add files from one directory of a filesystem recursively, assuming this is a .protobuf root path.
+// Ex: dep.AddPathFS(embeddedFS, "include", fdep.DepType_Imported)
+func (d *Dep) AddPathFS(fsys fs.FS, dir string, deptype DepFileType) error {
+	return d.AddPathWithRootFS("", fsys, dir, deptype)
+}
+
+// Add files from one directory of a filesystem recursively, using "currentpath" as the root path of this directory.
+// Ex: dep.AddPathWithRootFS("google", embeddedFS, "include/google", fdep.DepType_Imported)
+func (d *Dep) AddPathWithRootFS(currentpath string, fsys fs.FS, dir string, deptype DepFileType) error {
+	d.mu.Lock()
+	d.roots = append(d.roots, pathRoot{currentpath: currentpath, fsys: fsys, dir: dir, deptype: deptype})
+	ignore := d.ignoreFilePaths()
+	d.mu.Unlock()
+
+	return d.addPathFiles(walkPathFS(ignore, currentpath, fsys, dir), deptype)
 }
 
 // Adds a single file to the dependency, assuming the file's path as "currentpath".
 // Ex: dep.AddFile("google/protobuf", "/protoc-3.5.1/include/google/protobuf/empty.proto", fdep.DepType_Imported)
 func (d *Dep) AddFile(currentpath string, filename string, deptype DepFileType) error {
 	// check if the path is on the ignore list
-	for _, ignore := range d.IgnoreFilePaths {
-		if strings.HasPrefix(currentpath, ignore) {
-			return nil
-		}
+	d.mu.RLock()
+	ignored := isIgnoredPath(d.IgnoreFilePaths, currentpath)
+	d.mu.RUnlock()
+	if ignored {
+		return nil
 	}
 
 	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("Error parsing file %s: %v", filename, err)
+		return fmt.Errorf("Error parsing file %s: %w", filename, err)
 	}
 	defer file.Close()
 
@@ -139,75 +297,356 @@ func (d *Dep) AddFile(currentpath string, filename string, deptype DepFileType)
 	fpath := path.Join(currentpath, gofilepath.Base(filename))
 
 	// reads the file
-	return d.AddReader(fpath, file, deptype)
+	pfile, err := d.parse(fpath, file)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addProtoFile(fpath, pfile, deptype, &fileSource{
+		fsys:     os.DirFS(gofilepath.Dir(filename)),
+		filename: gofilepath.Base(filename),
+	})
+}
+
+// Adds a single file from a filesystem to the dependency, assuming the file's path as "currentpath".
+// Ex: dep.AddFileFS("google/protobuf", embeddedFS, "include/google/protobuf/empty.proto", fdep.DepType_Imported)
+func (d *Dep) AddFileFS(currentpath string, fsys fs.FS, filename string, deptype DepFileType) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addFileFS(currentpath, fsys, filename, deptype)
+}
+
+func (d *Dep) addFileFS(currentpath string, fsys fs.FS, filename string, deptype DepFileType) error {
+	// check if the path is on the ignore list
+	if isIgnoredPath(d.IgnoreFilePaths, currentpath) {
+		return nil
+	}
+
+	// builds the file path
+	fpath := path.Join(currentpath, path.Base(filename))
+
+	// reads the file
+	pfile, err := d.parseFileFS(fpath, fsys, filename)
+	if err != nil {
+		return err
+	}
+
+	return d.addProtoFile(fpath, pfile, deptype, &fileSource{fsys: fsys, filename: filename})
+}
+
+// Returns a copy of the ignore list, to be used after the lock is released.
+func (d *Dep) ignoreFilePaths() []string {
+	return append([]string(nil), d.IgnoreFilePaths...)
+}
+
+// Checks if the path is on the ignore list.
+func isIgnoredPath(ignoreFilePaths []string, currentpath string) bool {
+	for _, ignore := range ignoreFilePaths {
+		if strings.HasPrefix(currentpath, ignore) {
+			return true
+		}
+	}
+	return false
 }
 
 // Adds a single file to the dependency, using an reader.
 // Ex: dep.AddReader("google/protobuf/Empty.proto", reader, fdep.DepType_Imported)
 func (d *Dep) AddReader(filepath string, r io.Reader, deptype DepFileType) error {
 	// parses the file
-	pfile, err := fproto.Parse(r)
+	pfile, err := d.parse(filepath, r)
 	if err != nil {
-		return fmt.Errorf("Error parsing file %s: %v", filepath, err)
+		return err
 	}
 
-	// adds the file to the list
-	d.Files[filepath] = &DepFile{
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addProtoFile(filepath, pfile, deptype, nil)
+}
+
+// Opens and parses a file from a filesystem. "filepath" is the internal path of the file.
+func (d *Dep) parseFileFS(filepath string, fsys fs.FS, filename string) (*fproto.ProtoFile, error) {
+	file, err := fsys.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	return d.parse(filepath, file)
+}
+
+// Parses a file. "filepath" is the internal path of the file.
+// This function must be safe to call from multiple goroutines.
+func (d *Dep) parse(filepath string, r io.Reader) (*fproto.ProtoFile, error) {
+	if d.ParseCache == nil || parseCacheSchema == "" {
+		pfile, err := fproto.Parse(r)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing file %s: %w", filepath, err)
+		}
+		return pfile, nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing file %s: %w", filepath, err)
+	}
+
+	key := parseCacheKey(parseCacheSchema, data)
+	if pfile, ok := d.ParseCache.Get(key); ok {
+		return pfile, nil
+	}
+
+	pfile, err := fproto.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing file %s: %w", filepath, err)
+	}
+
+	// the cache is only an optimization, so the parsed file is used even if it can't be stored
+	_ = d.ParseCache.Put(key, pfile)
+
+	return pfile, nil
+}
+
+// Adds a parsed file to the dependency, and loads its imports.
+// If a file with the same path already exists, it is replaced.
+// The source is where the file was read from, or nil if unknown.
+//
+// If an import can't be loaded or the file creates an import cycle, the file and the
+// imports loaded for it are removed, and the files they replaced are restored, so the
+// dependency is left unchanged.
+func (d *Dep) addProtoFile(filepath string, pfile *fproto.ProtoFile, deptype DepFileType, source *fileSource) (err error) {
+	// the outermost call rolls back the changes of the nested calls that load the imports
+	if d.changes == nil {
+		d.changes = &fileChanges{old: make(map[string]*DepFile)}
+		defer func() {
+			if err != nil {
+				d.rollbackChanges()
+			}
+			d.changes = nil
+		}()
+	}
+
+	// removes the indexes of the file being replaced
+	var replacedDeps []string
+	if old, ok := d.Files[filepath]; ok && old.ProtoFile != nil {
+		d.removeFileIndexes(old)
+		replacedDeps = old.ProtoFile.Dependencies
+	}
+
+	// adds the file to the list and to the indexes
+	d.setFile(filepath, &DepFile{
 		FilePath:  filepath,
 		DepType:   deptype,
 		Dep:       d,
 		ProtoFile: pfile,
-	}
+		source:    source,
+	})
+	d.addFileIndexes(filepath)
 
 	// load file dependencies
+	var errs []error
 	for _, fd := range pfile.Dependencies {
-		err = d.AddIncludeFile(fd)
+		err = d.addIncludeFile(filepath, fd)
 		if err != nil {
-			return err
+			if !d.ContinueOnError {
+				return err
+			}
+			errs = appendError(errs, err)
 		}
 	}
+	if len(errs) > 0 {
+		return newMultiError(errs)
+	}
 
-	// add to the package list
-	d.addPackage(filepath)
+	// imports of the replaced file that are not used anymore
+	d.removeUnusedStubs(replacedDeps)
 
-	// add to the extension list
-	d.addExtensions(filepath)
+	// check for import cycles
+	if cycle := d.findCycle(filepath, make(map[string]bool)); cycle != nil {
+		return &ImportCycleError{Cycle: cycle}
+	}
 
 	return nil
 }
 
+// Adds the file to the package list, the symbol index, the extension list and the
+// reverse dependency index.
+func (d *Dep) addFileIndexes(filepath string) {
+	if d.Files[filepath].ProtoFile == nil {
+		return
+	}
+
+	d.addPackage(filepath)
+	d.addSymbols(filepath)
+	d.addExtensions(filepath)
+	d.addImportedBy(filepath)
+}
+
+// The files changed by the addProtoFile call in progress.
+type fileChanges struct {
+	// The previous version of each changed file, nil if the file didn't exist.
+	old map[string]*DepFile
+
+	// The changed files, in the order they were first changed.
+	order []string
+}
+
+// Sets or, if df is nil, removes a file, recording the change if a file is being added.
+// The indexes must be updated by the caller.
+func (d *Dep) setFile(filepath string, df *DepFile) {
+	if d.changes != nil {
+		if _, ok := d.changes.old[filepath]; !ok {
+			d.changes.old[filepath] = d.Files[filepath]
+			d.changes.order = append(d.changes.order, filepath)
+		}
+	}
+
+	if df != nil {
+		d.Files[filepath] = df
+	} else {
+		delete(d.Files, filepath)
+	}
+	d.generation++
+}
+
+// Restores the files changed by the addProtoFile call in progress, with their indexes.
+func (d *Dep) rollbackChanges() {
+	changes := d.changes
+	d.changes = nil
+
+	for _, fp := range changes.order {
+		if df, ok := d.Files[fp]; ok {
+			d.removeFileIndexes(df)
+			delete(d.Files, fp)
+		}
+	}
+	for _, fp := range changes.order {
+		if old := changes.old[fp]; old != nil {
+			d.Files[fp] = old
+			d.addFileIndexes(fp)
+		}
+	}
+	d.generation++
+}
+
 // Adds an include file
 func (d *Dep) AddIncludeFile(filepath string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addIncludeFile("", filepath)
+}
+
+// Adds an include file imported by the "importer" file.
+// The directories added using the AddPath functions are searched before the include
+// directories, so files can import the other files of the same directory.
+func (d *Dep) addIncludeFile(importer string, filepath string) error {
 	if _, ok := d.Files[filepath]; ok {
 		// File already exists
 		return nil
 	}
 
-	for _, inc := range d.IncludeDirs {
-		inc_file := gofilepath.Join(inc, gofilepath.FromSlash(filepath))
+	if pf, ok := d.pathFiles[filepath]; ok {
+		return d.addParsedPathFile(pf)
+	}
 
-		// check if file exists
-		_, err := os.Stat(inc_file)
-		if err != nil && !os.IsNotExist(err) {
-			return err
-		} else if err == nil {
-			return d.AddFile(path.Dir(filepath), inc_file, DepType_Imported)
+	root, root_file, err := d.findRootFile(filepath)
+	if err != nil {
+		return err
+	} else if root_file != "" {
+		return d.addFileFS(path.Dir(filepath), root.fsys, root_file, root.deptype)
+	}
+
+	inc, inc_file, err := d.findIncludeFile(filepath)
+	if err != nil {
+		return err
+	} else if inc_file != "" {
+		return d.addFileFS(path.Dir(filepath), inc.FS, inc_file, DepType_Imported)
+	}
+
+	if !d.IgnoreNotFoundDependencies {
+		return &DependencyNotFoundError{
+			FilePath:   importer,
+			Dependency: filepath,
 		}
 	}
 
 	// Add file as if it was found, but without a parsed file and without package references
-	d.Files[filepath] = &DepFile{
+	d.setFile(filepath, &DepFile{
 		FilePath:  filepath,
 		DepType:   DepType_Imported,
 		Dep:       d,
 		ProtoFile: nil,
-	}
+		NotFound:  true,
+	})
 
 	return nil
 }
 
+// Searches for a file in the directories added using the AddPath functions, returning the
+// directory and the file name inside its filesystem. The file name is blank if not found.
+func (d *Dep) findRootFile(filepath string) (pathRoot, string, error) {
+	for _, root := range d.roots {
+		rel := filepath
+		if root.currentpath != "" {
+			if !strings.HasPrefix(filepath, root.currentpath+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(filepath, root.currentpath+"/")
+		}
+
+		root_file := path.Join(root.dir, rel)
+		if !fs.ValidPath(root_file) {
+			continue
+		}
+
+		// check if file exists
+		_, err := fs.Stat(root.fsys, root_file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return pathRoot{}, "", err
+		} else if err == nil {
+			return root, root_file, nil
+		}
+	}
+	return pathRoot{}, "", nil
+}
+
+// Searches for a file in the include directories, returning the include directory and the
+// file name inside its filesystem. The file name is blank if not found.
+func (d *Dep) findIncludeFile(filepath string) (IncludeDirFS, string, error) {
+	for _, inc := range d.allIncludeDirs() {
+		inc_file := path.Join(inc.Dir, filepath)
+		if !fs.ValidPath(inc_file) {
+			continue
+		}
+
+		// check if file exists
+		_, err := fs.Stat(inc.FS, inc_file)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return IncludeDirFS{}, "", err
+		} else if err == nil {
+			return inc, inc_file, nil
+		}
+	}
+	return IncludeDirFS{}, "", nil
+}
+
+// Returns the include directories of the filesystem followed by the ones inside filesystems.
+func (d *Dep) allIncludeDirs() []IncludeDirFS {
+	var ret []IncludeDirFS
+	for _, inc := range d.IncludeDirs {
+		ret = append(ret, IncludeDirFS{FS: os.DirFS(inc), Dir: "."})
+	}
+	return append(ret, d.IncludeDirsFS...)
+}
+
 // Adds files from a provider
 func (d *Dep) AddFileProvider(fp FileProvider) error {
+	var errs []error
 	for fp.HasNext() {
 		filepath, r, deptype, err := fp.GetNext()
 		if err != nil {
@@ -216,10 +655,13 @@ func (d *Dep) AddFileProvider(fp FileProvider) error {
 
 		err = d.AddReader(filepath, r, deptype)
 		if err != nil {
-			return err
+			if !d.ContinueOnError {
+				return err
+			}
+			errs = appendError(errs, err)
 		}
 	}
-	return nil
+	return newMultiError(errs)
 }
 
 // Adds the package of the file to the Packages list.
@@ -232,6 +674,29 @@ func (d *Dep) addPackage(filepath string) {
 	d.Packages[pkg] = append(d.Packages[pkg], filepath)
 }
 
+// Adds the imports of the file to the reverse dependency index.
+func (d *Dep) addImportedBy(filepath string) {
+	pfile := d.Files[filepath].ProtoFile
+	if d.importedBy == nil {
+		// allocated here so a Dep created without NewDep also works
+		d.importedBy = make(map[string]map[string]bool)
+	}
+	for _, fd := range pfile.Dependencies {
+		if _, ok := d.importedBy[fd]; !ok {
+			d.importedBy[fd] = make(map[string]bool)
+		}
+
+		public := false
+		for _, pd := range pfile.PublicDependencies {
+			if pd == fd {
+				public = true
+				break
+			}
+		}
+		d.importedBy[fd][filepath] = public
+	}
+}
+
 // Add message extensions
 func (d *Dep) addExtensions(filepath string) {
 	prfile := d.Files[filepath].ProtoFile
@@ -250,12 +715,17 @@ func (d *Dep) addMessageExtension(prfile *fproto.ProtoFile, extendmessage *fprot
 	}
 }
 
+// Checks if all imported files were found. Only useful if IgnoreNotFoundDependencies is true,
+// otherwise the loading functions already fail on the first file not found.
 func (d *Dep) CheckDependencies() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	var nfound []string
 
-	// found found dependencies have their "ProtoFile" field nil
+	// not found dependencies have their "ProtoFile" field nil
 	for _, file := range d.Files {
-		if file.ProtoFile == nil {
+		if file.NotFound || file.ProtoFile == nil {
 			nfound = append(nfound, file.FilePath)
 		}
 	}
@@ -267,6 +737,71 @@ func (d *Dep) CheckDependencies() error {
 	return nil
 }
 
+// Checks if there are import cycles between the files.
+// If there are, returns an *ImportCycleError with the first cycle found.
+// As files that create a cycle are not added, this only fails if the Files were changed directly.
+func (d *Dep) CheckCycles() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	done := make(map[string]bool)
+	for _, filepath := range d.sortedFilePaths() {
+		if cycle := d.findCycle(filepath, done); cycle != nil {
+			return &ImportCycleError{Cycle: cycle}
+		}
+	}
+	return nil
+}
+
+// Searches for an import cycle reachable from the file, returning the cycle path if found.
+// Files in "done" were already checked and are skipped, and files checked are added to it.
+func (d *Dep) findCycle(filepath string, done map[string]bool) []string {
+	var stack []string
+	onstack := make(map[string]int)
+
+	var visit func(fp string) []string
+	visit = func(fp string) []string {
+		if idx, ok := onstack[fp]; ok {
+			cycle := append([]string{}, stack[idx:]...)
+			return append(cycle, fp)
+		}
+		if done[fp] {
+			return nil
+		}
+
+		df, ok := d.Files[fp]
+		if !ok || df.ProtoFile == nil {
+			done[fp] = true
+			return nil
+		}
+
+		onstack[fp] = len(stack)
+		stack = append(stack, fp)
+		for _, fd := range df.ProtoFile.Dependencies {
+			if cycle := visit(fd); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		delete(onstack, fp)
+		done[fp] = true
+
+		return nil
+	}
+
+	return visit(filepath)
+}
+
+// Returns the paths of all files, sorted.
+func (d *Dep) sortedFilePaths() []string {
+	ret := make([]string, 0, len(d.Files))
+	for filepath := range d.Files {
+		ret = append(ret, filepath)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 // Builds a list of valid package names from the dotted name.
 // for example, if name = "google.protobuf.Empty", this will search for
 // package "google", then "google.protobuf", but only "google.protobuf" will
@@ -275,6 +810,13 @@ func (d *Dep) CheckDependencies() error {
 // The map item value will contain the rest of the type name, in the example case,
 // "Empty". It can also contain dots in case of nested items.
 func (d *Dep) FindPackagesOfName(name string) map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.findPackagesOfName(name)
+}
+
+func (d *Dep) findPackagesOfName(name string) map[string]string {
 	pkgs := make(map[string]string)
 
 	nameparts := strings.Split(name, ".")
@@ -342,6 +884,8 @@ func (d *Dep) GetTypeExtension(name string, extensionPkg string) (*DepType, erro
 }
 
 // Returns all named types from the dependency.
+// Messages, enums and services are returned as their canonical types, the same
+// pointers returned by LookupSymbol.
 //
 // Use this method if there is a possibility that one name resolves to more than one type.
 func (d *Dep) GetTypes(name string) ([]*DepType, error) {
@@ -351,6 +895,9 @@ func (d *Dep) GetTypes(name string) ([]*DepType, error) {
 // This functions is the one that really does the type finding.
 // If depfile is not-nil, the type is returned in relation to it.
 func (d *Dep) internalGetTypes(name string, depfile *DepFile) ([]*DepType, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	ret := make([]*DepType, 0)
 
 	// check if is scalar
@@ -358,19 +905,31 @@ func (d *Dep) internalGetTypes(name string, depfile *DepFile) ([]*DepType, error
 		ret = append(ret, NewDepTypeScalar(scalar))
 	}
 
-	// locate the name into the own depfile
-	if depfile != nil {
-		for _, t := range depfile.ProtoFile.FindName(name) {
-			switch t.(type) {
-			case fproto.FieldElementTag:
-				// ignore fields
-			default:
-				ret = append(ret, NewDepType(depfile, "", depfile.OriginalAlias(), name, t))
+	// locate the name into the own depfile, using the symbol index
+	if depfile != nil && depfile.ProtoFile != nil {
+		localname := name
+		if depfile.ProtoFile.PackageName != "" {
+			localname = depfile.ProtoFile.PackageName + "." + name
+		}
+		for _, t := range d.symbols[localname] {
+			if t.DepFile.FilePath == depfile.FilePath {
+				ret = append(ret, t)
 			}
 		}
 	}
 
-	pkgs := d.FindPackagesOfName(name)
+	// fast path using the symbol index
+	if syms, ok := d.findSymbols(name, depfile); ok {
+		// without a package, the types of the own depfile were already found
+		for _, t := range syms {
+			if !containsDepType(ret, t) {
+				ret = append(ret, t)
+			}
+		}
+		return ret, nil
+	}
+
+	pkgs := d.findPackagesOfName(name)
 
 	if len(pkgs) == 0 {
 		if len(ret) > 0 {
@@ -388,21 +947,21 @@ func (d *Dep) internalGetTypes(name string, depfile *DepFile) ([]*DepType, error
 
 			if depfile != nil {
 				// If a file was passed, only check on the dependencies of the file.
-				for _, ffdep := range depfile.FindDependencies() {
-					if ffdep == f {
-						include_file = true
-						break
-					}
-				}
+				include_file = depfile.dependencySet()[f]
 			} else {
 				// Else check all files
 				include_file = true
 			}
 
-			if include_file {
-				// Search the name on the current proto file.
+			if include_file && d.Files[f].ProtoFile != nil {
+				// Search the name on the current proto file. Only the names that are not
+				// on the symbol index, like fields, are expected here.
 				for _, t := range d.Files[f].ProtoFile.FindName(spname) {
-					ret = append(ret, NewDepType(d.Files[f], sppkg, sppkg, spname, t))
+					if st, ok := d.symbolItems[t]; ok {
+						ret = append(ret, st)
+					} else {
+						ret = append(ret, NewDepType(d.Files[f], sppkg, sppkg, spname, t))
+					}
 				}
 			}
 		}
@@ -441,7 +1000,10 @@ func (d *Dep) GetFilesOfName(name string) ([]*DepFileOfName, error) {
 // Gets the files of a name. Try all package names until a file is found.
 // The type itself that may be on the name is ignored.
 func (d *Dep) internalGetFilesOfName(name string, depfile *DepFile) ([]*DepFileOfName, error) {
-	pkgs := d.FindPackagesOfName(name)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	pkgs := d.findPackagesOfName(name)
 
 	if len(pkgs) == 0 {
 		return nil, nil
@@ -457,12 +1019,7 @@ func (d *Dep) internalGetFilesOfName(name string, depfile *DepFile) ([]*DepFileO
 
 			if depfile != nil {
 				// If a file was passed, only check on the dependencies of the file.
-				for _, ffdep := range depfile.FindDependencies() {
-					if ffdep == f {
-						include_file = true
-						break
-					}
-				}
+				include_file = depfile.dependencySet()[f]
 			} else {
 				// Else check all files
 				include_file = true
@@ -489,6 +1046,9 @@ func (d *Dep) internalGetFilesOfName(name string, depfile *DepFile) ([]*DepFileO
 
 // Get a list for extension packages for a type.
 func (d *Dep) GetExtensions(depfile *DepFile, originalAlias string, name string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	var ret []string
 
 	fname := name
@@ -565,6 +1125,9 @@ func (d *Dep) internalGetOptions(optionItem OptionItem, name string, depfile *De
 	if err != nil {
 		return nil, fmt.Errorf("Error gettint the source type '%s': %v", srcTypeName, err)
 	}
+	if sourceType == nil {
+		return nil, fmt.Errorf("Source type '%s' not found", srcTypeName)
+	}
 
 	var ret []*OptionType
 	for _, dn := range depnames {
@@ -1,8 +1,14 @@
 package fdep
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+
+	"github.com/RangelReale/fproto"
 )
 
 func TestDep(t *testing.T) {
@@ -53,8 +59,8 @@ func TestDep(t *testing.T) {
 		t.Fatalf("Error getting type User from user.proto: %v", err)
 	}
 
-	if f_user_type.Alias != "" {
-		t.Fatalf("User from user.proto's alias should be blank, but is '%s'", f_user_type.Alias)
+	if f_user_type.Alias != "p_user" {
+		t.Fatalf("User from user.proto's alias should be 'p_user', but is '%s'", f_user_type.Alias)
 	}
 
 	if user_type.Name != "User" {
@@ -75,3 +81,252 @@ func TestDep(t *testing.T) {
 		t.Fatalf("google.protobuf.Empty name should be 'Empty', but is '%s'", empty_type.Name)
 	}
 }
+
+func TestDepFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/myapp/proto/p_user/user.proto":            {Data: []byte(testfile_user)},
+		"include/google/protobuf/empty.proto":          {Data: []byte(testfile_google_empty)},
+		"include/google/protobuf/not_a_proto_file.txt": {Data: []byte("ignored")},
+	}
+
+	dep := NewDep()
+	err := dep.AddIncludeDirFS(fsys, "include")
+	if err != nil {
+		t.Fatalf("Error adding include dir: %v", err)
+	}
+
+	err = dep.AddPathFS(fsys, "app", DepType_Own)
+	if err != nil {
+		t.Fatalf("Error adding path: %v", err)
+	}
+
+	if len(dep.Files) != 2 {
+		t.Fatalf("Should have loaded 2 files, but loaded %d", len(dep.Files))
+	}
+
+	empty_file, ok := dep.Files["google/protobuf/empty.proto"]
+	if !ok {
+		t.Fatalf("File google/protobuf/empty.proto should have been loaded from the include dir")
+	}
+
+	if empty_file.DepType != DepType_Imported || empty_file.ProtoFile == nil {
+		t.Fatalf("File google/protobuf/empty.proto should be a parsed imported file")
+	}
+
+	if _, err := dep.GetType("p_user.User"); err != nil {
+		t.Fatalf("Error getting type p_user.User: %v", err)
+	}
+}
+
+func TestDepNotFoundDependencies(t *testing.T) {
+	// strict mode is the default, also for a Dep created without NewDep
+	literal := &Dep{Files: make(map[string]*DepFile), Packages: make(map[string][]string), Extensions: make(map[string][]string)}
+	if err := literal.AddReader("myapp/proto/p_user/user.proto", strings.NewReader(testfile_user), DepType_Own); err == nil {
+		t.Fatalf("Missing imports should not be ignored by default")
+	}
+
+	dep := NewDep()
+	err := dep.AddReader("myapp/proto/p_user/user.proto", strings.NewReader(testfile_user), DepType_Own)
+	if err == nil {
+		t.Fatalf("Adding user.proto without its dependencies should fail")
+	}
+
+	var nferr *DependencyNotFoundError
+	if !errors.As(err, &nferr) {
+		t.Fatalf("Error should be a *DependencyNotFoundError, but is %T: %v", err, err)
+	}
+
+	if nferr.FilePath != "myapp/proto/p_user/user.proto" || nferr.Dependency != "google/protobuf/empty.proto" {
+		t.Fatalf("Unexpected not found error data: %s imports %s", nferr.FilePath, nferr.Dependency)
+	}
+
+	// lenient mode
+	dep = NewDep()
+	dep.IgnoreNotFoundDependencies = true
+	err = dep.AddReader("myapp/proto/p_user/user.proto", strings.NewReader(testfile_user), DepType_Own)
+	if err != nil {
+		t.Fatalf("Error parsing test user proto: %v", err)
+	}
+
+	stub, ok := dep.Files["google/protobuf/empty.proto"]
+	if !ok || !stub.NotFound || stub.ProtoFile != nil {
+		t.Fatalf("File google/protobuf/empty.proto should have been added as a not found stub")
+	}
+
+	user_file := dep.Files["myapp/proto/p_user/user.proto"]
+	if stub.IsSame(user_file) || user_file.IsSame(stub) || stub.IsSamePackage(user_file) {
+		t.Fatalf("Stub file should not be the same as user.proto")
+	}
+
+	if stub.GoPackage() != "" {
+		t.Fatalf("Stub file go package should be blank, but is '%s'", stub.GoPackage())
+	}
+
+	if _, err := stub.GetTypes("Empty"); err != nil {
+		t.Fatalf("Error getting types from stub file: %v", err)
+	}
+
+	if _, err := user_file.GetTypes("google.protobuf.Empty"); err != nil {
+		t.Fatalf("Error getting types from user.proto: %v", err)
+	}
+
+	if err := dep.CheckDependencies(); err == nil {
+		t.Fatalf("CheckDependencies should report google/protobuf/empty.proto as not found")
+	}
+}
+
+func TestDepNotFoundRollback(t *testing.T) {
+	fsys := fstest.MapFS{
+		"include/p_c/c.proto": {Data: []byte(testfile_public_c)},
+	}
+
+	// c.proto is loaded from the include dir, but its import is missing
+	dep := NewDep()
+	if err := dep.AddIncludeDirFS(fsys, "include"); err != nil {
+		t.Fatalf("Error adding include dir: %v", err)
+	}
+	err := dep.AddReader("p_b/b.proto", strings.NewReader(testfile_public_b), DepType_Own)
+
+	var nferr *DependencyNotFoundError
+	if !errors.As(err, &nferr) || nferr.Dependency != "p_d/d.proto" {
+		t.Fatalf("Error should be a *DependencyNotFoundError for p_d/d.proto, but is %v", err)
+	}
+
+	if len(dep.GetFiles()) != 0 || len(dep.GetPackages()) != 0 {
+		t.Fatalf("The failed file and its imports should not have been added")
+	}
+
+	// a failed replacement restores the previous file
+	dep = newTestDep(t, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+		{"p_c/c.proto", testfile_public_c, DepType_Own},
+	})
+
+	d_type, err := dep.GetType("p_d.D")
+	if err != nil {
+		t.Fatalf("Error getting type p_d.D: %v", err)
+	}
+
+	err = dep.ReloadReader("p_d/d.proto", strings.NewReader(strings.Replace(testfile_public_d, "package p_d;", "package p_d;\nimport \"p_x/x.proto\";", 1)))
+	if !errors.As(err, &nferr) || nferr.Dependency != "p_x/x.proto" {
+		t.Fatalf("Error should be a *DependencyNotFoundError for p_x/x.proto, but is %v", err)
+	}
+
+	if dep.GetFile("p_x/x.proto") != nil || len(dep.GetFile("p_d/d.proto").ProtoFile.Dependencies) != 0 {
+		t.Fatalf("The previous p_d/d.proto should have been restored")
+	}
+	if tp, err := dep.GetType("p_d.D"); err != nil || tp != d_type {
+		t.Fatalf("The restored type should be the same canonical type: %v", err)
+	}
+	if i := dep.GetImporters(dep.GetFile("p_d/d.proto")); len(i) != 1 {
+		t.Fatalf("p_d/d.proto should have 1 importer, but has %d", len(i))
+	}
+}
+
+func TestDepImportCycle(t *testing.T) {
+	dep := NewDep()
+	dep.IgnoreNotFoundDependencies = true
+	err := dep.AddReader("p_cycle/a.proto", strings.NewReader(testfile_cycle_a), DepType_Own)
+	if err != nil {
+		t.Fatalf("Error parsing a.proto: %v", err)
+	}
+
+	err = dep.AddReader("p_cycle/b.proto", strings.NewReader(testfile_cycle_b), DepType_Own)
+	if err == nil {
+		t.Fatalf("Adding b.proto should fail with an import cycle")
+	}
+
+	var cycleerr *ImportCycleError
+	if !errors.As(err, &cycleerr) {
+		t.Fatalf("Error should be an *ImportCycleError, but is %T: %v", err, err)
+	}
+
+	if cycle := strings.Join(cycleerr.Cycle, " -> "); cycle != "p_cycle/b.proto -> p_cycle/a.proto -> p_cycle/b.proto" {
+		t.Fatalf("Unexpected import cycle: %s", cycle)
+	}
+
+	// the file that creates the cycle is not added
+	if df := dep.GetFile("p_cycle/b.proto"); df == nil || !df.NotFound {
+		t.Fatalf("p_cycle/b.proto should have been kept as a not found stub")
+	}
+
+	if err := dep.CheckCycles(); err != nil {
+		t.Fatalf("There should be no import cycle: %v", err)
+	}
+
+	if _, err := dep.TopologicalOrder(); err != nil {
+		t.Fatalf("Error getting topological order: %v", err)
+	}
+
+	// a direct change to the files is reported
+	dep.Files["p_cycle/b.proto"].ProtoFile = &fproto.ProtoFile{Dependencies: []string{"p_cycle/a.proto"}}
+	if err := dep.CheckCycles(); !errors.As(err, &cycleerr) {
+		t.Fatalf("CheckCycles should report the import cycle, but returned %v", err)
+	}
+}
+
+// Run with "go test -race" to check for data races.
+func TestDepConcurrent(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Own},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+		{"p_c/c.proto", testfile_public_c, DepType_Own},
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+
+	// files added while other goroutines are looking up types
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, f := range []struct{ filepath, content string }{
+			{"p_b/b.proto", testfile_public_b},
+			{"p_a/a.proto", testfile_public_a},
+			{"google/protobuf/empty.proto", testfile_google_empty},
+			{"myapp/proto/p_user/user.proto", testfile_user},
+		} {
+			if err := dep.AddReader(f.filepath, strings.NewReader(f.content), DepType_Own); err != nil {
+				errs <- err
+			}
+		}
+	}()
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := dep.GetType("p_d.D"); err != nil {
+					errs <- err
+				}
+				if _, err := dep.GetTypes("p_user.User"); err != nil {
+					errs <- err
+				}
+				if o, err := dep.GetOption(FIELD_OPTION, "p_option.jsontag"); err != nil {
+					errs <- err
+				} else if o == nil {
+					errs <- fmt.Errorf("Option p_option.jsontag not found")
+				}
+				if df := dep.GetFile("p_a/a.proto"); df != nil {
+					if _, err := df.GetTypes("p_d.D"); err != nil {
+						errs <- err
+					}
+					if deps := df.FindDependencies(); len(deps) == 0 || deps[0] != "p_b/b.proto" {
+						errs <- fmt.Errorf("Unexpected dependencies of p_a/a.proto: %v", deps)
+					}
+				}
+				dep.GetPackages()
+				dep.GetFiles()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("Error on concurrent access: %v", err)
+	}
+}
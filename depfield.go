@@ -0,0 +1,208 @@
+package fdep
+
+import (
+	"fmt"
+
+	"github.com/RangelReale/fproto"
+)
+
+// The label of a field.
+type FieldLabel int
+
+const (
+	// No label, like proto3 singular fields and oneof fields.
+	FieldLabel_None FieldLabel = iota
+	FieldLabel_Optional
+	FieldLabel_Required
+	FieldLabel_Repeated
+)
+
+func (l FieldLabel) String() string {
+	switch l {
+	case FieldLabel_None:
+		return ""
+	case FieldLabel_Optional:
+		return "optional"
+	case FieldLabel_Required:
+		return "required"
+	case FieldLabel_Repeated:
+		return "repeated"
+	default:
+		return "unknown"
+	}
+}
+
+// Returns the label of a field element.
+func fieldElementLabel(fld *fproto.FieldElement) FieldLabel {
+	switch {
+	case fld.Repeated:
+		return FieldLabel_Repeated
+	case fld.Required:
+		return FieldLabel_Required
+	case fld.Optional:
+		return FieldLabel_Optional
+	default:
+		return FieldLabel_None
+	}
+}
+
+// A field of a message or extend block, with its types resolved.
+type DepField struct {
+	// The message or extend block that contains the field.
+	Owner *DepType
+
+	// The field name.
+	Name string
+
+	// The field number.
+	Number int
+
+	// The field label. Map fields are always FieldLabel_Repeated.
+	Label FieldLabel
+
+	// The resolved type of the field. For map fields, the value type.
+	Type *DepType
+
+	// For map fields, the resolved key type. Nil for other fields.
+	MapKeyType *DepType
+
+	// The oneof that contains the field, or nil. There is one oneof DepType per
+	// *fproto.OneOfFieldElement, shared by all its fields, so they can be compared by pointer.
+	OneOf *DepType
+
+	// The json name, from the "json_name" option or generated from the field name
+	// the same way protoc does.
+	JSONName string
+
+	// The value of the "default" option, or blank if not set.
+	DefaultValue string
+
+	// The options of the field, excluding "default" and "json_name".
+	Options []*fproto.OptionElement
+
+	// The field element, a *fproto.FieldElement or a *fproto.MapFieldElement.
+	Item fproto.FieldElementTag
+}
+
+// Returns whether the field is a map.
+func (f *DepField) IsMap() bool {
+	return f.MapKeyType != nil
+}
+
+// Returns the fields of a message or extend block, in declaration order, with the fields
+// of oneofs in place. The types are resolved in the same scope as GetTypes, and for extend
+// blocks, in the scope where the block is declared.
+//
+// The fields are computed once and cached until the dependency changes, so they must not be
+// modified. The owner of the fields is always the canonical type of the element. Returns an error if the type is not a message or extend block, or if any field
+// type is not found or is ambiguous.
+func (d *DepType) Fields() ([]*DepField, error) {
+	m, ok := d.Item.(*fproto.MessageElement)
+	if !ok || d.DepFile == nil {
+		return nil, fmt.Errorf("Type '%s' is not a message", d.TypeDescription())
+	}
+
+	dep := d.DepFile.Dep
+
+	dep.mu.RLock()
+	generation := dep.generation
+	dep.mu.RUnlock()
+
+	dep.fieldsMu.Lock()
+	if dep.fields == nil || dep.fieldsGeneration != generation {
+		dep.fields = make(map[fproto.FProtoElement][]*DepField)
+		dep.fieldsGeneration = generation
+	}
+	fields, ok := dep.fields[m]
+	dep.fieldsMu.Unlock()
+	if ok {
+		return fields, nil
+	}
+
+	fields, err := d.buildFields(m)
+	if err != nil {
+		return nil, err
+	}
+
+	dep.fieldsMu.Lock()
+	if dep.fieldsGeneration == generation {
+		dep.fields[m] = fields
+	}
+	dep.fieldsMu.Unlock()
+
+	return fields, nil
+}
+
+func (d *DepType) buildFields(m *fproto.MessageElement) ([]*DepField, error) {
+	df := d.DepFile
+
+	// the fields are cached by element, so they are built from the canonical type and
+	// don't depend on the type used to ask for them
+	owner := df.Dep.elementType(df, m)
+	scope := fieldScope(owner)
+
+	var ret []*DepField
+
+	addField := func(fld *fproto.FieldElement, oneof *DepType) (*DepField, error) {
+		t, err := df.resolveTypeName(scope, fld.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		f := &DepField{
+			Owner:    owner,
+			Name:     fld.Name,
+			Number:   fld.Tag,
+			Type:     t,
+			Label:    fieldElementLabel(fld),
+			OneOf:    oneof,
+			JSONName: jsonName(fld.Name),
+			Item:     fld,
+		}
+
+		for _, o := range fld.Options {
+			switch o.Name {
+			case "default":
+				f.DefaultValue = o.Value.String()
+			case "json_name":
+				f.JSONName = o.Value.String()
+			default:
+				f.Options = append(f.Options, o)
+			}
+		}
+
+		ret = append(ret, f)
+		return f, nil
+	}
+
+	for _, fld := range m.Fields {
+		switch xfld := fld.(type) {
+		case *fproto.FieldElement:
+			if _, err := addField(xfld, nil); err != nil {
+				return nil, err
+			}
+		case *fproto.MapFieldElement:
+			f, err := addField(xfld.FieldElement, nil)
+			if err != nil {
+				return nil, err
+			}
+			f.MapKeyType, err = df.resolveTypeName(scope, xfld.KeyType)
+			if err != nil {
+				return nil, err
+			}
+			f.Label = FieldLabel_Repeated
+			f.Item = xfld
+		case *fproto.OneOfFieldElement:
+			oneof := NewDepTypeOneOf(df, xfld)
+			for _, oofld := range xfld.Fields {
+				if ooxfld, ok := oofld.(*fproto.FieldElement); ok {
+					if _, err := addField(ooxfld, oneof); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	return ret, nil
+}
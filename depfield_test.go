@@ -0,0 +1,149 @@
+package fdep
+
+import "testing"
+
+func TestDepFields(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Imported},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+	})
+
+	gt, err := dep.GetType("p_descriptor.Group")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+
+	fields, err := gt.Fields()
+	if err != nil {
+		t.Fatalf("Error getting fields: %v", err)
+	}
+	if len(fields) != 4 {
+		t.Fatalf("Expected 4 fields, got %d", len(fields))
+	}
+
+	if fields[0].Name != "group_name" || fields[0].JSONName != "groupName" || !fields[0].Type.IsScalar() {
+		t.Fatalf("Unexpected field %s (%s)", fields[0].Name, fields[0].JSONName)
+	}
+
+	um := fields[1]
+	if !um.IsMap() || um.Label != FieldLabel_Repeated {
+		t.Fatalf("Field %s should be a repeated map", um.Name)
+	}
+	if um.MapKeyType.ScalarType.ProtoType() != "string" {
+		t.Fatalf("Unexpected map key type %s", um.MapKeyType.ScalarType.ProtoType())
+	}
+	if um.Type.FullOriginalName() != "p_user.User" {
+		t.Fatalf("Unexpected map value type %s", um.Type.FullOriginalName())
+	}
+
+	for _, f := range fields[2:] {
+		if f.OneOf == nil {
+			t.Fatalf("Field %s should be on a oneof", f.Name)
+		}
+	}
+	if fields[2].OneOf != fields[3].OneOf {
+		t.Fatal("Fields of the same oneof should share the oneof type")
+	}
+	for _, f := range fields {
+		if f.Owner != gt {
+			t.Fatalf("The owner of field %s should be the message", f.Name)
+		}
+	}
+	if fields[2].Type.FullOriginalName() != "p_user.User" {
+		t.Fatalf("Unexpected field type %s", fields[2].Type.FullOriginalName())
+	}
+
+	fields2, err := gt.Fields()
+	if err != nil {
+		t.Fatalf("Error getting fields: %v", err)
+	}
+	if fields[0] != fields2[0] {
+		t.Fatal("Fields should be cached")
+	}
+
+	if _, err := fields[0].Type.Fields(); err == nil {
+		t.Fatal("Fields of a non-message should fail")
+	}
+}
+
+func TestDepFieldsOwner(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Imported},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+	})
+
+	ut, err := dep.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+
+	// a type that is not canonical, with another alias, asks first
+	other := NewDepType(ut.DepFile, "", "", ut.Name, ut.Item)
+	fields, err := other.Fields()
+	if err != nil {
+		t.Fatalf("Error getting fields: %v", err)
+	}
+	fields2, err := ut.Fields()
+	if err != nil {
+		t.Fatalf("Error getting fields: %v", err)
+	}
+	if len(fields) == 0 || len(fields) != len(fields2) || fields[0] != fields2[0] {
+		t.Fatal("Fields should be cached by element")
+	}
+	for _, f := range fields {
+		if f.Owner != ut {
+			t.Fatalf("The owner of field %s should be the canonical type", f.Name)
+		}
+	}
+}
+
+func TestDepFieldsExtend(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+	})
+
+	df := dep.GetFile("p_option/option.proto")
+	if df == nil || len(df.ProtoFile.ExtendMessages) != 1 {
+		t.Fatal("File p_option/option.proto should have one extend block")
+	}
+	et := dep.DepTypeFromElement(df.ProtoFile.ExtendMessages[0])
+
+	fields, err := et.Fields()
+	if err != nil {
+		t.Fatalf("Error getting fields: %v", err)
+	}
+	if len(fields) != 1 || fields[0].Name != "jsontag" || fields[0].Owner != et {
+		t.Fatal("The owner of the extend field should be the extend block")
+	}
+}
+
+func TestDepFieldsDefaultValue(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"p_defaults/defaults.proto", testfile_defaults, DepType_Own},
+	})
+
+	st, err := dep.GetType("p_defaults.Settings")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	fields, err := st.Fields()
+	if err != nil {
+		t.Fatalf("Error getting fields: %v", err)
+	}
+	if len(fields) != 3 {
+		t.Fatalf("Expected 3 fields, got %d", len(fields))
+	}
+
+	// quoted strings are returned without the quotes, and enums as the value name
+	if fields[0].DefaultValue != "hello world" {
+		t.Fatalf("Unexpected string default value %q", fields[0].DefaultValue)
+	}
+	if fields[1].DefaultValue != "HIGH" || fields[1].Type.FullOriginalName() != "p_defaults.Level" {
+		t.Fatalf("Unexpected enum default value %q", fields[1].DefaultValue)
+	}
+	if fields[2].DefaultValue != "10" || fields[2].JSONName != "total" || len(fields[2].Options) != 0 {
+		t.Fatalf("Unexpected default value %q and json name %q", fields[2].DefaultValue, fields[2].JSONName)
+	}
+}
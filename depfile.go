@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/RangelReale/fproto"
 )
@@ -44,10 +46,34 @@ type DepFile struct {
 
 	// The parsed proto file. Can be nil it was from an ignored dependency.
 	ProtoFile *fproto.ProtoFile
+
+	// Whether the file was imported but not found in any include directory.
+	// This only happens when Dep.IgnoreNotFoundDependencies is true, and ProtoFile is nil in this case.
+	NotFound bool
+
+	// Where the file was read from, used by Dep.ReloadFile. Nil if unknown.
+	source *fileSource
+
+	// The canonical types of the file on the symbol index.
+	symbols []*DepType
+
+	// The canonical types of the extend blocks of the file.
+	extends []*DepType
+
+	// Cache of FindDependencies. Replaced when Dep.generation changes.
+	dependencies atomic.Pointer[depFileDependencies]
+}
+
+// The dependencies of a file for one Dep generation. They are built only once, even
+// when several goroutines holding the read lock ask for them at the same time.
+type depFileDependencies struct {
+	generation int
+	once       sync.Once
+	list       []string
+	set        map[string]bool
 }
 
 // Returns one named type from the dependency, in relation to the current file.
-// If the type is from the current file, the "Alias" field is blank.
 //
 // If multiple types are found for the same name, an error is issued.
 // If there is this possibility, use the GetTypes method instead.
@@ -81,7 +107,8 @@ func (df *DepFile) GetType(name string) (*DepType, error) {
 }
 
 // Returns all named types from the dependency, in relation to the current file.
-// If the type is from the current file, the "Alias" field is blank.
+// Messages, enums and services are returned as their canonical types, including the ones
+// from the current file, which have the package as the "Alias" field. See LookupSymbol.
 //
 // If not found using the name, the current file's package is searched recursivelly
 // appending the name.
@@ -133,7 +160,7 @@ func (df *DepFile) IsSame(depfile *DepFile) bool {
 		return true
 	}
 
-	if df.FilePath == depfile.FilePath && df.ProtoFile.PackageName == depfile.ProtoFile.PackageName {
+	if df.FilePath == depfile.FilePath && df.OriginalAlias() == depfile.OriginalAlias() {
 		return true
 	}
 
@@ -149,11 +176,15 @@ func (df *DepFile) OriginalAlias() string {
 
 // Checks if the passed DepFile refers to the same package as this one.
 func (df *DepFile) IsSamePackage(depfile *DepFile) bool {
+	if depfile == nil {
+		return false
+	}
+
 	if df == depfile {
 		return true
 	}
 
-	if path.Dir(df.FilePath) == path.Dir(depfile.FilePath) && df.ProtoFile.PackageName == depfile.ProtoFile.PackageName {
+	if path.Dir(df.FilePath) == path.Dir(depfile.FilePath) && df.OriginalAlias() == depfile.OriginalAlias() {
 		return true
 	}
 
@@ -161,7 +192,12 @@ func (df *DepFile) IsSamePackage(depfile *DepFile) bool {
 }
 
 // Returns the go package of the file. If there is no "go_package" option, returns the "path" part of the package name.
+// Returns blank if the file was not found.
 func (df *DepFile) GoPackage() string {
+	if df.ProtoFile == nil {
+		return ""
+	}
+
 	for _, o := range df.ProtoFile.Options {
 		if o.Name == "go_package" {
 			return o.Value.String()
@@ -171,16 +207,84 @@ func (df *DepFile) GoPackage() string {
 }
 
 // Find all dependencies of file, include public ones from imports.
+// Like protoc, this is the direct imports of the file plus the transitive closure
+// of the public imports of these, which are the files whose types are visible to this file.
+//
+// The result is cached until a file is added to or removed from the dependency.
 func (df *DepFile) FindDependencies() []string {
-	var ret []string
-	if df.ProtoFile != nil {
-		ret = append(ret, df.ProtoFile.Dependencies...)
-		for _, pd := range df.ProtoFile.PublicDependencies {
-			if pdf, ispdf := df.Dep.Files[pd]; ispdf && pdf.ProtoFile != nil {
-				ret = append(ret, pdf.ProtoFile.PublicDependencies...)
+	df.Dep.mu.RLock()
+	defer df.Dep.mu.RUnlock()
+
+	return df.findDependencies()
+}
+
+func (df *DepFile) findDependencies() []string {
+	list := df.loadDependencies().list
+	return list[:len(list):len(list)]
+}
+
+// Returns the dependencies of the file as a set. Must not be modified.
+func (df *DepFile) dependencySet() map[string]bool {
+	return df.loadDependencies().set
+}
+
+func (df *DepFile) loadDependencies() *depFileDependencies {
+	deps := df.dependencies.Load()
+	if deps == nil || deps.generation != df.Dep.generation {
+		// the generation only changes while holding the write lock, so if another
+		// goroutine stored its cache first, it is for the current generation
+		newdeps := &depFileDependencies{generation: df.Dep.generation}
+		if df.dependencies.CompareAndSwap(deps, newdeps) {
+			deps = newdeps
+		} else {
+			deps = df.dependencies.Load()
+		}
+	}
+
+	deps.once.Do(func() {
+		deps.list = df.buildDependencies()
+		deps.set = make(map[string]bool, len(deps.list))
+		for _, fp := range deps.list {
+			deps.set[fp] = true
+		}
+	})
+	return deps
+}
+
+func (df *DepFile) buildDependencies() []string {
+	ret := []string{}
+	if df.ProtoFile == nil {
+		return ret
+	}
+
+	added := map[string]bool{df.FilePath: true}
+
+	// add the public dependencies of a file, recursivelly
+	var addPublic func(filepath string)
+	addPublic = func(filepath string) {
+		pdf, ispdf := df.Dep.Files[filepath]
+		if !ispdf || pdf.ProtoFile == nil {
+			return
+		}
+		for _, pd := range pdf.ProtoFile.PublicDependencies {
+			if !added[pd] {
+				added[pd] = true
+				ret = append(ret, pd)
+				addPublic(pd)
 			}
 		}
 	}
+
+	for _, fd := range df.ProtoFile.Dependencies {
+		if !added[fd] {
+			added[fd] = true
+			ret = append(ret, fd)
+		}
+	}
+	for _, fd := range df.ProtoFile.Dependencies {
+		addPublic(fd)
+	}
+
 	return ret
 }
 
@@ -0,0 +1,37 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepPublicDependencies(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+		{"p_c/c.proto", testfile_public_c, DepType_Own},
+		{"p_b/b.proto", testfile_public_b, DepType_Own},
+		{"p_a/a.proto", testfile_public_a, DepType_Own},
+	})
+
+	a_file := dep.Files["p_a/a.proto"]
+
+	deps := strings.Join(a_file.FindDependencies(), ",")
+	if deps != "p_b/b.proto,p_c/c.proto,p_d/d.proto" {
+		t.Fatalf("Unexpected dependencies of a.proto: %s", deps)
+	}
+
+	// p_d.D is visible through 2 levels of public imports
+	d_type, err := a_file.GetType("p_d.D")
+	if err != nil {
+		t.Fatalf("Error getting type p_d.D from a.proto: %v", err)
+	}
+
+	if d_type.DepFile.FilePath != "p_d/d.proto" {
+		t.Fatalf("p_d.D should be from p_d/d.proto, but is from %s", d_type.DepFile.FilePath)
+	}
+
+	// b.proto don't see a.proto
+	if t_a, _ := dep.Files["p_b/b.proto"].FindType("p_a.A"); t_a != nil {
+		t.Fatalf("p_a.A should not be visible from b.proto")
+	}
+}
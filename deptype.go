@@ -13,8 +13,8 @@ type DepType struct {
 	DepFile *DepFile
 
 	// The alias of the type. Can vary depending of how the type was requested.
-	// When returned on the DepFile scope, it can be blank if it is contained on
-	// the file itself.
+	// Messages, enums and services always have their package, even when returned on
+	// the DepFile scope of the file itself.
 	Alias string
 
 	// The original alias of the type, independently of how it was requested.
@@ -61,7 +61,10 @@ func NewDepTypeFromElement(depfile *DepFile, element fproto.FProtoElement) *DepT
 	return NewDepType(depfile, depfile.OriginalAlias(), depfile.OriginalAlias(), fproto.ScopedName(element), element)
 }
 
-// Returns the name plus alias, if available
+// Returns whether both types have the same file, original alias and name.
+// This also matches the types of a file that was reloaded, and the local and global
+// canonical types of the same element, which are different pointers. Use it instead of
+// pointer equality to compare types returned by different lookups, see LookupSymbol.
 func (d *DepType) IsSame(od *DepType) bool {
 	if d.IsScalar() != od.IsScalar() ||
 		(d.IsScalar() && od.IsScalar() && *d.ScalarType != *od.ScalarType) {
@@ -86,11 +89,19 @@ func (d *DepType) IsSame(od *DepType) bool {
 // Returns the parent deptype, or nil if root
 func (d *DepType) Parent() *DepType {
 	if d.Item != nil && d.Item.ParentElement() != nil {
-		return NewDepTypeFromElement(d.DepFile, d.Item.ParentElement())
+		return d.elementType(d.Item.ParentElement())
 	}
 	return nil
 }
 
+// Returns the canonical type of an element of the same file.
+func (d *DepType) elementType(element fproto.FProtoElement) *DepType {
+	if d.DepFile.Dep != nil {
+		return d.DepFile.Dep.elementType(d.DepFile, element)
+	}
+	return NewDepTypeFromElement(d.DepFile, element)
+}
+
 // Returns up to the n-th parent if possible, excluding the ProtFile.
 // The second return value is the amount found.
 func (d *DepType) SkipParents(n int) (*DepType, int) {
@@ -114,7 +125,7 @@ func (d *DepType) SkipParents(n int) (*DepType, int) {
 		return nil, 0
 	}
 
-	return NewDepTypeFromElement(d.DepFile, cur), ct
+	return d.elementType(cur), ct
 }
 
 // Returns the name plus alias, if available
@@ -0,0 +1,761 @@
+package fdep
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/RangelReale/fproto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The maximum field number, exclusive, as used on descriptor extension ranges.
+const descriptorMaxFieldNumber = 536870912
+
+// Returns all files as a FileDescriptorSet, in dependency order, like
+// "protoc --include_imports --descriptor_set_out" does.
+// All type names are resolved using the fdep resolution, and an error is returned
+// if any of them is not found or is ambiguous, or if any file was not found.
+// Custom options are set as extensions of the options messages, resolved against the
+// extensions declared on the files. The ones that can't be resolved, like message
+// values, option names with subfields, or all of them if the files can't be linked,
+// are kept as uninterpreted options.
+func (d *Dep) FileDescriptorSet() (*descriptorpb.FileDescriptorSet, error) {
+	files, err := d.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &descriptorpb.FileDescriptorSet{}
+	for _, df := range files {
+		fd, err := df.FileDescriptorProto()
+		if err != nil {
+			return nil, err
+		}
+		ret.File = append(ret.File, fd)
+	}
+
+	if types := descriptorExtensionTypes(ret.File); types != nil {
+		for _, fd := range ret.File {
+			resolveCustomOptions(fd.ProtoReflect(), fd.GetPackage(), types)
+		}
+	}
+	return ret, nil
+}
+
+// Writes all files as a binary FileDescriptorSet.
+func (d *Dep) WriteFileDescriptorSet(w io.Writer) error {
+	fds, err := d.FileDescriptorSet()
+	if err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(fds)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// Returns the file as a FileDescriptorProto.
+// All type names are resolved to fully-qualified names using the fdep resolution.
+// Custom options are kept as uninterpreted options, use FileDescriptorSet to resolve them.
+func (df *DepFile) FileDescriptorProto() (*descriptorpb.FileDescriptorProto, error) {
+	if df.NotFound || df.ProtoFile == nil {
+		return nil, fmt.Errorf("File %s was not found", df.FilePath)
+	}
+
+	b := &descriptorBuilder{
+		depfile:        df,
+		messages:       make(map[fproto.FProtoElement]*descriptorpb.DescriptorProto),
+		proto3Optional: make(map[*descriptorpb.DescriptorProto][]*descriptorpb.FieldDescriptorProto),
+		oneofs:         make(map[*fproto.FieldElement]int32),
+		services:       make(map[fproto.FProtoElement]*descriptorpb.ServiceDescriptorProto),
+		extendees:      make(map[fproto.FProtoElement]string),
+	}
+	if err := df.Walk(b); err != nil {
+		return nil, err
+	}
+
+	// proto3 optional fields get synthetic oneofs after the real ones
+	for _, md := range b.messageOrder {
+		addSyntheticOneofs(md, b.proto3Optional[md])
+	}
+
+	return b.file, nil
+}
+
+// A Visitor that builds the descriptors of one file.
+type descriptorBuilder struct {
+	BaseVisitor
+	depfile *DepFile
+	file    *descriptorpb.FileDescriptorProto
+
+	// the message descriptors by element, in the order they were visited
+	messages     map[fproto.FProtoElement]*descriptorpb.DescriptorProto
+	messageOrder []*descriptorpb.DescriptorProto
+
+	// the proto3 optional fields of each message
+	proto3Optional map[*descriptorpb.DescriptorProto][]*descriptorpb.FieldDescriptorProto
+
+	// the oneof index of the fields declared inside oneofs
+	oneofs map[*fproto.FieldElement]int32
+
+	// the service descriptors by element
+	services map[fproto.FProtoElement]*descriptorpb.ServiceDescriptorProto
+
+	// the fully-qualified extended type name of each extend block
+	extendees map[fproto.FProtoElement]string
+}
+
+// Returns the descriptor of the message that contains the element, or nil if it is
+// declared on the file root.
+func (b *descriptorBuilder) parentMessage(element fproto.FProtoElement) *descriptorpb.DescriptorProto {
+	return b.messages[element.ParentElement()]
+}
+
+func (b *descriptorBuilder) VisitFile(df *DepFile) error {
+	pfile := df.ProtoFile
+
+	b.file = &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(df.FilePath),
+		Dependency: pfile.Dependencies,
+	}
+	if pfile.PackageName != "" {
+		b.file.Package = proto.String(pfile.PackageName)
+	}
+	if pfile.Syntax == "proto3" {
+		b.file.Syntax = proto.String(pfile.Syntax)
+	}
+
+	for _, pd := range pfile.PublicDependencies {
+		for di, dep := range pfile.Dependencies {
+			if dep == pd {
+				b.file.PublicDependency = append(b.file.PublicDependency, int32(di))
+				break
+			}
+		}
+	}
+
+	if len(pfile.Options) > 0 {
+		b.file.Options = &descriptorpb.FileOptions{}
+		descriptorOptions(pfile.Options, b.file.Options)
+	}
+	return nil
+}
+
+func (b *descriptorBuilder) VisitMessage(message *DepType) error {
+	m := message.Item.(*fproto.MessageElement)
+
+	ret := &descriptorpb.DescriptorProto{
+		Name: proto.String(m.Name),
+	}
+
+	if len(m.Options) > 0 {
+		ret.Options = &descriptorpb.MessageOptions{}
+		descriptorOptions(m.Options, ret.Options)
+	}
+
+	for _, er := range m.Extensions {
+		end := int32(er.End) + 1
+		if er.End <= 0 || end > descriptorMaxFieldNumber {
+			end = descriptorMaxFieldNumber
+		}
+		ret.ExtensionRange = append(ret.ExtensionRange, &descriptorpb.DescriptorProto_ExtensionRange{
+			Start: proto.Int32(int32(er.Start)),
+			End:   proto.Int32(end),
+		})
+	}
+
+	if parent := b.parentMessage(m); parent != nil {
+		parent.NestedType = append(parent.NestedType, ret)
+	} else {
+		b.file.MessageType = append(b.file.MessageType, ret)
+	}
+	b.messages[m] = ret
+	b.messageOrder = append(b.messageOrder, ret)
+	return nil
+}
+
+func (b *descriptorBuilder) VisitField(owner *DepType, fld *fproto.FieldElement, fieldType *DepType) error {
+	fd, err := b.buildField(fld, fieldType)
+	if err != nil {
+		return err
+	}
+
+	// fields of extend blocks are extensions of the scope where the block is declared
+	if extendee, ok := b.extendees[owner.Item]; ok {
+		fd.Extendee = proto.String(extendee)
+		if parent := b.parentMessage(owner.Item); parent != nil {
+			parent.Extension = append(parent.Extension, fd)
+		} else {
+			b.file.Extension = append(b.file.Extension, fd)
+		}
+		return nil
+	}
+
+	md := b.messages[owner.Item]
+	if oneofIndex, ok := b.oneofs[fld]; ok {
+		fd.OneofIndex = proto.Int32(oneofIndex)
+	} else if fld.Optional && b.depfile.ProtoFile.Syntax == "proto3" {
+		fd.Proto3Optional = proto.Bool(true)
+		b.proto3Optional[md] = append(b.proto3Optional[md], fd)
+	}
+	md.Field = append(md.Field, fd)
+	return nil
+}
+
+func (b *descriptorBuilder) VisitMapField(owner *DepType, fld *fproto.MapFieldElement, keyType *DepType, valueType *DepType) error {
+	md, ok := b.messages[owner.Item]
+	if !ok {
+		// not valid on extend blocks
+		return nil
+	}
+
+	fd, entry, err := b.buildMapField(owner, fld, keyType, valueType)
+	if err != nil {
+		return err
+	}
+	md.Field = append(md.Field, fd)
+	md.NestedType = append(md.NestedType, entry)
+	return nil
+}
+
+func (b *descriptorBuilder) VisitOneOf(owner *DepType, oneof *fproto.OneOfFieldElement) error {
+	md, ok := b.messages[owner.Item]
+	if !ok {
+		// not valid on extend blocks
+		return SkipChildren
+	}
+
+	od := &descriptorpb.OneofDescriptorProto{
+		Name: proto.String(oneof.Name),
+	}
+	if len(oneof.Options) > 0 {
+		od.Options = &descriptorpb.OneofOptions{}
+		descriptorOptions(oneof.Options, od.Options)
+	}
+	md.OneofDecl = append(md.OneofDecl, od)
+
+	for _, fld := range oneof.Fields {
+		if xfld, ok := fld.(*fproto.FieldElement); ok {
+			b.oneofs[xfld] = int32(len(md.OneofDecl) - 1)
+		}
+	}
+	return nil
+}
+
+func (b *descriptorBuilder) VisitEnum(enum *DepType) error {
+	ed := b.buildEnum(enum.Item.(*fproto.EnumElement))
+	if parent := b.parentMessage(enum.Item); parent != nil {
+		parent.EnumType = append(parent.EnumType, ed)
+	} else {
+		b.file.EnumType = append(b.file.EnumType, ed)
+	}
+	return SkipChildren
+}
+
+func (b *descriptorBuilder) VisitService(service *DepType) error {
+	s := service.Item.(*fproto.ServiceElement)
+
+	ret := &descriptorpb.ServiceDescriptorProto{
+		Name: proto.String(s.Name),
+	}
+	if len(s.Options) > 0 {
+		ret.Options = &descriptorpb.ServiceOptions{}
+		descriptorOptions(s.Options, ret.Options)
+	}
+
+	b.file.Service = append(b.file.Service, ret)
+	b.services[s] = ret
+	return nil
+}
+
+func (b *descriptorBuilder) VisitMethod(service *DepType, rpc *fproto.RPCElement, requestType *DepType, responseType *DepType) error {
+	md := &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(rpc.Name),
+		InputType:  proto.String(descriptorTypeName(requestType)),
+		OutputType: proto.String(descriptorTypeName(responseType)),
+	}
+	if rpc.StreamsRequest {
+		md.ClientStreaming = proto.Bool(true)
+	}
+	if rpc.StreamsResponse {
+		md.ServerStreaming = proto.Bool(true)
+	}
+	if len(rpc.Options) > 0 {
+		md.Options = &descriptorpb.MethodOptions{}
+		descriptorOptions(rpc.Options, md.Options)
+	}
+
+	sd := b.services[service.Item]
+	sd.Method = append(sd.Method, md)
+	return nil
+}
+
+func (b *descriptorBuilder) VisitExtend(extend *DepType, extendedType *DepType) error {
+	b.extendees[extend.Item] = descriptorTypeName(extendedType)
+	return nil
+}
+
+// Adds the synthetic oneofs of the proto3 optional fields, named like protoc does:
+// the field name prefixed by "_", and by "X" until it doesn't conflict with other names.
+func addSyntheticOneofs(md *descriptorpb.DescriptorProto, fields []*descriptorpb.FieldDescriptorProto) {
+	names := make(map[string]bool)
+	for _, fd := range md.Field {
+		names[fd.GetName()] = true
+	}
+	for _, od := range md.OneofDecl {
+		names[od.GetName()] = true
+	}
+
+	for _, fd := range fields {
+		name := fd.GetName()
+		if !strings.HasPrefix(name, "_") {
+			name = "_" + name
+		}
+		for names[name] {
+			name = "X" + name
+		}
+		names[name] = true
+
+		md.OneofDecl = append(md.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(name)})
+		fd.OneofIndex = proto.Int32(int32(len(md.OneofDecl) - 1))
+	}
+}
+
+// Builds a field with its resolved type.
+func (b *descriptorBuilder) buildField(fld *fproto.FieldElement, fieldType *DepType) (*descriptorpb.FieldDescriptorProto, error) {
+	ret := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(fld.Name),
+		Number:   proto.Int32(int32(fld.Tag)),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		JsonName: proto.String(jsonName(fld.Name)),
+	}
+	switch fieldElementLabel(fld) {
+	case FieldLabel_Repeated:
+		ret.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	case FieldLabel_Required:
+		ret.Label = descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum()
+	}
+
+	if err := setFieldType(ret, fieldType, fld.Type); err != nil {
+		return nil, err
+	}
+
+	// "default" and "json_name" are not real options
+	var options []*fproto.OptionElement
+	for _, o := range fld.Options {
+		switch o.Name {
+		case "default":
+			if fieldType.IsScalar() && *fieldType.ScalarType == fproto.BytesScalar {
+				// bytes are C-escaped on the descriptor
+				ret.DefaultValue = proto.String(protoEscape(o.Value.String()))
+			} else {
+				ret.DefaultValue = proto.String(o.Value.String())
+			}
+		case "json_name":
+			ret.JsonName = proto.String(o.Value.String())
+		default:
+			options = append(options, o)
+		}
+	}
+	if len(options) > 0 {
+		ret.Options = &descriptorpb.FieldOptions{}
+		descriptorOptions(options, ret.Options)
+	}
+
+	return ret, nil
+}
+
+// Builds a map field of the message and its synthesized entry message.
+func (b *descriptorBuilder) buildMapField(message *DepType, fld *fproto.MapFieldElement, keyType *DepType, valueType *DepType) (*descriptorpb.FieldDescriptorProto, *descriptorpb.DescriptorProto, error) {
+	ret, err := b.buildField(fld.FieldElement, valueType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entryName := camelCase(fld.Name) + "Entry"
+	ret.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	ret.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	ret.TypeName = proto.String(descriptorTypeName(message) + "." + entryName)
+
+	key := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("key"),
+		Number:   proto.Int32(1),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		JsonName: proto.String("key"),
+	}
+	if err := setFieldType(key, keyType, fld.KeyType); err != nil {
+		return nil, nil, err
+	}
+
+	value := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("value"),
+		Number:   proto.Int32(2),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		JsonName: proto.String("value"),
+	}
+	if err := setFieldType(value, valueType, fld.Type); err != nil {
+		return nil, nil, err
+	}
+
+	entry := &descriptorpb.DescriptorProto{
+		Name:  proto.String(entryName),
+		Field: []*descriptorpb.FieldDescriptorProto{key, value},
+		Options: &descriptorpb.MessageOptions{
+			MapEntry: proto.Bool(true),
+		},
+	}
+
+	return ret, entry, nil
+}
+
+// Sets the type and type name of the field from its resolved type. The name is the
+// type name as written, used on errors.
+func setFieldType(fd *descriptorpb.FieldDescriptorProto, t *DepType, name string) error {
+	if t.IsScalar() {
+		v, ok := descriptorpb.FieldDescriptorProto_Type_value["TYPE_"+strings.ToUpper(t.ScalarType.ProtoType())]
+		if !ok {
+			return fmt.Errorf("Unknown scalar type '%s'", t.ScalarType.ProtoType())
+		}
+		fd.Type = descriptorpb.FieldDescriptorProto_Type(v).Enum()
+		return nil
+	}
+
+	switch t.Item.(type) {
+	case *fproto.MessageElement:
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	case *fproto.EnumElement:
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+	default:
+		return fmt.Errorf("Type '%s' is not a message or enum", name)
+	}
+	fd.TypeName = proto.String(descriptorTypeName(t))
+	return nil
+}
+
+func (b *descriptorBuilder) buildEnum(e *fproto.EnumElement) *descriptorpb.EnumDescriptorProto {
+	ret := &descriptorpb.EnumDescriptorProto{
+		Name: proto.String(e.Name),
+	}
+	if len(e.Options) > 0 {
+		ret.Options = &descriptorpb.EnumOptions{}
+		descriptorOptions(e.Options, ret.Options)
+	}
+
+	for _, ec := range e.EnumConstants {
+		ecd := &descriptorpb.EnumValueDescriptorProto{
+			Name:   proto.String(ec.Name),
+			Number: proto.Int32(int32(ec.Tag)),
+		}
+		if len(ec.Options) > 0 {
+			ecd.Options = &descriptorpb.EnumValueOptions{}
+			descriptorOptions(ec.Options, ecd.Options)
+		}
+		ret.Value = append(ret.Value, ecd)
+	}
+	return ret
+}
+
+// Returns the fully-qualified name of the type, with a leading dot.
+func descriptorTypeName(t *DepType) string {
+	ret := t.DepFile.Dep.elementType(t.DepFile, t.Item).FullOriginalName()
+	return "." + ret
+}
+
+// Sets the options on the descriptor options message. Options that are not fields of
+// the message, like custom options, or whose values cannot be converted, are set as
+// uninterpreted options.
+func descriptorOptions(options []*fproto.OptionElement, msg proto.Message) {
+	m := msg.ProtoReflect()
+	for _, o := range options {
+		if fd := m.Descriptor().Fields().ByName(protoreflect.Name(o.Name)); fd != nil && !fd.IsList() {
+			if v, ok := descriptorOptionValue(fd, o.Value.String()); ok {
+				m.Set(fd, v)
+				continue
+			}
+		}
+
+		uo := uninterpretedOption(o)
+		list := m.Mutable(m.Descriptor().Fields().ByName("uninterpreted_option")).List()
+		list.Append(protoreflect.ValueOfMessage(uo.ProtoReflect()))
+	}
+}
+
+// Resolves the custom options of the descriptor and its children, set as uninterpreted
+// options, against the extension types. "scope" is the fully-qualified name of the
+// package or message where the options are declared.
+func resolveCustomOptions(m protoreflect.Message, scope string, types *protoregistry.Types) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil:
+		case fd.Name() == "options":
+			resolveUninterpretedOptions(v.Message(), scope, types)
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				child := list.Get(i).Message()
+				childScope := scope
+				if md, ok := child.Interface().(*descriptorpb.DescriptorProto); ok {
+					childScope = strings.TrimPrefix(scope+"."+md.GetName(), ".")
+				}
+				resolveCustomOptions(child, childScope, types)
+			}
+		}
+		return true
+	})
+}
+
+// Sets the uninterpreted options of the options message that name an extension of it
+// as the extension value, and keeps the other ones.
+func resolveUninterpretedOptions(opts protoreflect.Message, scope string, types *protoregistry.Types) {
+	ufd := opts.Descriptor().Fields().ByName("uninterpreted_option")
+	if ufd == nil || !opts.Has(ufd) {
+		return
+	}
+
+	list := opts.Get(ufd).List()
+	kept := opts.NewField(ufd).List()
+	for i := 0; i < list.Len(); i++ {
+		uo := list.Get(i).Message().Interface().(*descriptorpb.UninterpretedOption)
+		if xt := findOptionExtension(uo, scope, types); xt != nil &&
+			xt.TypeDescriptor().ContainingMessage().FullName() == opts.Descriptor().FullName() {
+			xd := xt.TypeDescriptor()
+			if value, ok := uninterpretedOptionValue(uo); ok {
+				if v, ok := descriptorOptionValue(xd, value); ok {
+					if xd.IsList() {
+						opts.Mutable(xd).List().Append(v)
+					} else {
+						opts.Set(xd, v)
+					}
+					continue
+				}
+			}
+		}
+		kept.Append(list.Get(i))
+	}
+
+	if kept.Len() > 0 {
+		opts.Set(ufd, protoreflect.ValueOfList(kept))
+	} else {
+		opts.Clear(ufd)
+	}
+}
+
+// Returns the extension named by an uninterpreted option like "(p_option.jsontag)",
+// searching from the scope outwards like protoc does, or nil if not found.
+func findOptionExtension(uo *descriptorpb.UninterpretedOption, scope string, types *protoregistry.Types) protoreflect.ExtensionType {
+	if len(uo.Name) != 1 || !uo.Name[0].GetIsExtension() {
+		return nil
+	}
+
+	name := uo.Name[0].GetNamePart()
+	for {
+		fullName := name
+		if scope != "" {
+			fullName = scope + "." + name
+		}
+		if xt, err := types.FindExtensionByName(protoreflect.FullName(fullName)); err == nil {
+			return xt
+		}
+		if scope == "" {
+			return nil
+		}
+		if p := strings.LastIndex(scope, "."); p >= 0 {
+			scope = scope[:p]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// Returns the value of an uninterpreted option as written on the source, without quotes.
+// Aggregate values are not supported.
+func uninterpretedOptionValue(uo *descriptorpb.UninterpretedOption) (string, bool) {
+	switch {
+	case uo.IdentifierValue != nil:
+		return uo.GetIdentifierValue(), true
+	case uo.PositiveIntValue != nil:
+		return strconv.FormatUint(uo.GetPositiveIntValue(), 10), true
+	case uo.NegativeIntValue != nil:
+		return strconv.FormatInt(uo.GetNegativeIntValue(), 10), true
+	case uo.DoubleValue != nil:
+		return strconv.FormatFloat(uo.GetDoubleValue(), 'g', -1, 64), true
+	case uo.StringValue != nil:
+		return string(uo.StringValue), true
+	}
+	return "", false
+}
+
+// Converts an option value string to the type of the field.
+func descriptorOptionValue(fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, bool) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return protoreflect.ValueOfBool(v), true
+		}
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), true
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), true
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if v, err := strconv.ParseInt(value, 0, 32); err == nil {
+			return protoreflect.ValueOfInt32(int32(v)), true
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if v, err := strconv.ParseInt(value, 0, 64); err == nil {
+			return protoreflect.ValueOfInt64(v), true
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if v, err := strconv.ParseUint(value, 0, 32); err == nil {
+			return protoreflect.ValueOfUint32(uint32(v)), true
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if v, err := strconv.ParseUint(value, 0, 64); err == nil {
+			return protoreflect.ValueOfUint64(v), true
+		}
+	case protoreflect.FloatKind:
+		if v, err := strconv.ParseFloat(value, 32); err == nil {
+			return protoreflect.ValueOfFloat32(float32(v)), true
+		}
+	case protoreflect.DoubleKind:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return protoreflect.ValueOfFloat64(v), true
+		}
+	}
+	return protoreflect.Value{}, false
+}
+
+// Converts an option to an uninterpreted option, like protoc does for custom options
+// before they are resolved.
+func uninterpretedOption(o *fproto.OptionElement) *descriptorpb.UninterpretedOption {
+	ret := &descriptorpb.UninterpretedOption{}
+
+	// option names like "(validate.rules).string.min_len"
+	name := o.Name
+	for name != "" {
+		if strings.HasPrefix(name, "(") {
+			end := strings.Index(name, ")")
+			if end < 0 {
+				end = len(name)
+			}
+			ret.Name = append(ret.Name, &descriptorpb.UninterpretedOption_NamePart{
+				NamePart:    proto.String(strings.TrimPrefix(name[1:end], ".")),
+				IsExtension: proto.Bool(true),
+			})
+			if end < len(name) {
+				end++
+			}
+			name = strings.TrimPrefix(name[end:], ".")
+			continue
+		}
+
+		part := name
+		if p := strings.Index(name, "."); p >= 0 {
+			part, name = name[:p], name[p+1:]
+		} else {
+			name = ""
+		}
+		ret.Name = append(ret.Name, &descriptorpb.UninterpretedOption_NamePart{
+			NamePart:    proto.String(part),
+			IsExtension: proto.Bool(false),
+		})
+	}
+
+	value := o.Value.String()
+	if u, err := strconv.ParseUint(value, 0, 64); err == nil {
+		ret.PositiveIntValue = proto.Uint64(u)
+	} else if i, err := strconv.ParseInt(value, 0, 64); err == nil {
+		ret.NegativeIntValue = proto.Int64(i)
+	} else if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) {
+		ret.DoubleValue = proto.Float64(f)
+	} else if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+		ret.AggregateValue = proto.String(strings.TrimSpace(value[1 : len(value)-1]))
+	} else if isIdentifier(value) {
+		ret.IdentifierValue = proto.String(value)
+	} else {
+		ret.StringValue = []byte(value)
+	}
+	return ret
+}
+
+// Returns whether the string is a proto identifier.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Returns the json name of a field name, the same way protoc does.
+func jsonName(name string) string {
+	var ret strings.Builder
+	upper := false
+	for _, c := range name {
+		if c == '_' {
+			upper = true
+		} else if upper {
+			ret.WriteString(strings.ToUpper(string(c)))
+			upper = false
+		} else {
+			ret.WriteRune(c)
+		}
+	}
+	return ret.String()
+}
+
+// Returns the camel case name of a field name, used for map entry message names,
+// the same way protoc does.
+func camelCase(name string) string {
+	ret := jsonName(name)
+	if ret == "" {
+		return ret
+	}
+	return strings.ToUpper(ret[:1]) + ret[1:]
+}
+
+// Returns the string with the C escapes protoc uses, as on the default values of
+// bytes fields. Printable ASCII characters are kept, and the other bytes are
+// written as octal escapes.
+func protoEscape(s string) string {
+	var ret strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\n':
+			ret.WriteString(`\n`)
+		case '\r':
+			ret.WriteString(`\r`)
+		case '\t':
+			ret.WriteString(`\t`)
+		case '"':
+			ret.WriteString(`\"`)
+		case '\'':
+			ret.WriteString(`\'`)
+		case '\\':
+			ret.WriteString(`\\`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&ret, "\\%03o", c)
+			} else {
+				ret.WriteByte(c)
+			}
+		}
+	}
+	return ret.String()
+}
@@ -0,0 +1,184 @@
+package fdep
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDepFileDescriptorSet(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+	})
+
+	fds, err := dep.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	if len(fds.File) != 3 || fds.File[2].GetName() != "p_descriptor/descriptor.proto" {
+		t.Fatalf("File descriptor set should have 3 files in dependency order")
+	}
+
+	// must be accepted by the official protobuf library
+	_, err = protodesc.NewFiles(fds)
+	if err != nil {
+		t.Fatalf("Invalid file descriptor set: %v", err)
+	}
+
+	group := fds.File[2].MessageType[0]
+	if len(group.Field) != 4 || len(group.OneofDecl) != 1 || len(group.NestedType) != 1 {
+		t.Fatalf("Unexpected Group descriptor: %v", group)
+	}
+
+	if f := group.Field[1]; f.GetTypeName() != ".p_descriptor.Group.UserMapEntry" || f.GetJsonName() != "userMap" ||
+		!group.NestedType[0].GetOptions().GetMapEntry() {
+		t.Fatalf("Unexpected map field descriptor: %v", f)
+	}
+
+	if f := group.Field[2]; f.GetTypeName() != ".p_user.User" || f.OneofIndex == nil {
+		t.Fatalf("Unexpected oneof field descriptor: %v", f)
+	}
+
+	if m := fds.File[1].Service[0].Method[0]; m.GetInputType() != ".google.protobuf.Empty" {
+		t.Fatalf("Unexpected method descriptor: %v", m)
+	}
+}
+
+// The descriptor protoc generates for testfile_optional, with the synthetic oneofs
+// after the real one.
+const testfile_optional_protoc = `
+name: "p_optional/optional.proto"
+package: "p_optional"
+message_type {
+  name: "Item"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" oneof_index: 1 proto3_optional: true }
+  field { name: "a" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "a" oneof_index: 0 }
+  field { name: "b" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "b" oneof_index: 0 }
+  field { name: "count" number: 4 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "count" oneof_index: 2 proto3_optional: true }
+  field { name: "_size" number: 5 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "Size" }
+  field { name: "size" number: 6 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "size" oneof_index: 3 proto3_optional: true }
+  oneof_decl { name: "kind" }
+  oneof_decl { name: "_name" }
+  oneof_decl { name: "_count" }
+  oneof_decl { name: "X_size" }
+}
+syntax: "proto3"
+`
+
+func TestDepFileDescriptorProto3Optional(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"p_optional/optional.proto", testfile_optional, DepType_Own},
+	})
+
+	fd, err := dep.GetFile("p_optional/optional.proto").FileDescriptorProto()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor: %v", err)
+	}
+
+	expected := &descriptorpb.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(testfile_optional_protoc), expected); err != nil {
+		t.Fatalf("Error parsing the expected descriptor: %v", err)
+	}
+	if !proto.Equal(fd, expected) {
+		t.Fatalf("Descriptor is different from protoc's:\n%s", prototext.Format(fd))
+	}
+
+	file, err := protodesc.NewFile(fd, nil)
+	if err != nil {
+		t.Fatalf("Invalid file descriptor: %v", err)
+	}
+	item := file.Messages().Get(0)
+	if !item.Fields().ByName("name").HasPresence() || item.Fields().ByName("_size").HasPresence() {
+		t.Fatalf("Only proto3 optional fields should have presence")
+	}
+	if item.Oneofs().Len() != 4 || !item.Oneofs().Get(1).IsSynthetic() {
+		t.Fatalf("The proto3 optional fields should have synthetic oneofs")
+	}
+}
+
+func TestDepFileDescriptorNestedExtend(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_nested/nested.proto", testfile_nested_extend, DepType_Own},
+	})
+
+	fd, err := dep.GetFile("p_nested/nested.proto").FileDescriptorProto()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor: %v", err)
+	}
+
+	outer := fd.MessageType[0]
+	if len(fd.Extension) != 0 || len(outer.Extension) != 1 || len(outer.NestedType) != 1 {
+		t.Fatalf("The extension should be declared on the message: %v", fd)
+	}
+	if ext := outer.Extension[0]; ext.GetExtendee() != ".google.protobuf.FieldOptions" ||
+		ext.GetTypeName() != ".p_nested.Outer.Inner" {
+		t.Fatalf("Unexpected extension descriptor: %v", ext)
+	}
+}
+
+func TestDepFileDescriptorCustomOptions(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+	})
+
+	fds, err := dep.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	opts := fds.File[1].MessageType[0].Field[0].GetOptions()
+	if len(opts.GetUninterpretedOption()) != 0 {
+		t.Fatalf("The custom option should be resolved: %v", opts)
+	}
+
+	var value string
+	opts.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.FullName() == "p_option.jsontag" {
+			value = v.String()
+		}
+		return true
+	})
+	if value != "tagged_name" {
+		t.Fatalf("Unexpected value of the custom option: %v", opts)
+	}
+
+	// a single file can't resolve the extensions of its imports
+	fd, err := dep.GetFile("p_option/option.proto").FileDescriptorProto()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor: %v", err)
+	}
+	if uo := fd.MessageType[0].Field[0].GetOptions().GetUninterpretedOption(); len(uo) != 1 || uo[0].GetIdentifierValue() != "tagged_name" {
+		t.Fatalf("The custom option should be uninterpreted: %v", uo)
+	}
+}
+
+func TestDepFileDescriptorDefaultValues(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_option/option.proto", testfile_option, DepType_Imported},
+		{"p_escape/escape.proto", testfile_escape, DepType_Own},
+	})
+
+	fd, err := dep.GetFile("p_escape/escape.proto").FileDescriptorProto()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor: %v", err)
+	}
+
+	// strings are kept as is, and bytes are C-escaped
+	fields := fd.MessageType[0].Field
+	if v := fields[0].GetDefaultValue(); v != "héllo \"wörld\"\n\x01" {
+		t.Fatalf("Unexpected string default value %q", v)
+	}
+	if v := fields[1].GetDefaultValue(); v != `\303\251\000\'\377` {
+		t.Fatalf("Unexpected bytes default value %q", v)
+	}
+}
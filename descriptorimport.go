@@ -0,0 +1,642 @@
+package fdep
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Adds all files of a FileDescriptorSet, like the one generated by
+// "protoc --descriptor_set_out", to the dependency.
+// Each descriptor is converted back to a .proto source and parsed, so the files are
+// indexed exactly the same way as the ones added by AddReader.
+// Imports that are not on the set are searched on the include directories.
+func (d *Dep) AddFileDescriptorSet(fds *descriptorpb.FileDescriptorSet, deptype DepFileType) error {
+	return d.addFileDescriptors(fds.File, func(string) DepFileType {
+		return deptype
+	})
+}
+
+// Reads a binary FileDescriptorSet and adds all of its files to the dependency.
+func (d *Dep) AddFileDescriptorSetReader(r io.Reader, deptype DepFileType) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fds); err != nil {
+		return fmt.Errorf("Error reading file descriptor set: %w", err)
+	}
+
+	return d.AddFileDescriptorSet(fds, deptype)
+}
+
+// Adds the file descriptors, dependencies first. The deptype of each file is
+// returned by the passed function.
+func (d *Dep) addFileDescriptors(files []*descriptorpb.FileDescriptorProto, deptypeOf func(filepath string) DepFileType) error {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, fd := range files {
+		byName[fd.GetName()] = fd
+	}
+
+	// orders the files so the ones on the set are added before their importers
+	var order []*descriptorpb.FileDescriptorProto
+	done := make(map[string]bool)
+	var visit func(fd *descriptorpb.FileDescriptorProto)
+	visit = func(fd *descriptorpb.FileDescriptorProto) {
+		if done[fd.GetName()] {
+			return
+		}
+		done[fd.GetName()] = true
+		for _, dep := range fd.Dependency {
+			if dfd, ok := byName[dep]; ok {
+				visit(dfd)
+			}
+		}
+		order = append(order, fd)
+	}
+	for _, fd := range files {
+		visit(fd)
+	}
+
+	types := descriptorExtensionTypes(files)
+
+	var errs []error
+	for _, fd := range order {
+		src, err := descriptorSource(fd, types)
+		if err == nil {
+			err = d.addDescriptorSource(fd.GetName(), src, deptypeOf(fd.GetName()))
+		}
+		if err != nil {
+			if !d.ContinueOnError {
+				return err
+			}
+			errs = appendError(errs, err)
+		}
+	}
+
+	return newMultiError(errs)
+}
+
+// Parses and adds the source generated from a file descriptor.
+func (d *Dep) addDescriptorSource(filepath string, src string, deptype DepFileType) error {
+	pfile, err := d.parse(filepath, strings.NewReader(src))
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addProtoFile(filepath, pfile, deptype, nil)
+}
+
+// Returns the extension types declared on the files, used to decode custom options,
+// which are unknown fields when the descriptors are unmarshalled, and to resolve the
+// uninterpreted ones.
+// Returns nil if the files cannot be linked.
+func descriptorExtensionTypes(files []*descriptorpb.FileDescriptorProto) *protoregistry.Types {
+	reg, err := protodesc.FileOptions{AllowUnresolvable: true}.NewFiles(&descriptorpb.FileDescriptorSet{File: files})
+	if err != nil {
+		return nil
+	}
+
+	types := &protoregistry.Types{}
+	var addExtensions func(exts protoreflect.ExtensionDescriptors)
+	var addMessages func(msgs protoreflect.MessageDescriptors)
+	addExtensions = func(exts protoreflect.ExtensionDescriptors) {
+		for i := 0; i < exts.Len(); i++ {
+			types.RegisterExtension(dynamicpb.NewExtensionType(exts.Get(i)))
+		}
+	}
+	addMessages = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			addExtensions(msgs.Get(i).Extensions())
+			addMessages(msgs.Get(i).Messages())
+		}
+	}
+	reg.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		addExtensions(f.Extensions())
+		addMessages(f.Messages())
+		return true
+	})
+	return types
+}
+
+// Generates the .proto source of a file descriptor.
+func descriptorSource(fd *descriptorpb.FileDescriptorProto, types *protoregistry.Types) (string, error) {
+	w := &descriptorSourceWriter{
+		fd:    fd,
+		types: types,
+		local: make(map[string]bool),
+	}
+	return w.writeFile()
+}
+
+// Writes the .proto source of a file descriptor.
+type descriptorSourceWriter struct {
+	fd    *descriptorpb.FileDescriptorProto
+	types *protoregistry.Types
+
+	// fully-qualified names of the types declared on the file
+	local map[string]bool
+
+	b strings.Builder
+}
+
+func (w *descriptorSourceWriter) writeFile() (string, error) {
+	fd := w.fd
+
+	var collectLocal func(prefix string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto)
+	collectLocal = func(prefix string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto) {
+		for _, m := range msgs {
+			w.local[prefix+m.GetName()] = true
+			collectLocal(prefix+m.GetName()+".", m.NestedType, m.EnumType)
+		}
+		for _, e := range enums {
+			w.local[prefix+e.GetName()] = true
+		}
+	}
+	collectLocal(w.packagePrefix(), fd.MessageType, fd.EnumType)
+
+	if fd.GetSyntax() == "proto3" {
+		w.line(0, `syntax = "proto3";`)
+	} else {
+		w.line(0, `syntax = "proto2";`)
+	}
+	if fd.GetPackage() != "" {
+		w.line(0, "package %s;", fd.GetPackage())
+	}
+
+	for di, dep := range fd.Dependency {
+		kind := ""
+		for _, pd := range fd.PublicDependency {
+			if int(pd) == di {
+				kind = "public "
+			}
+		}
+		for _, wd := range fd.WeakDependency {
+			if int(wd) == di {
+				kind = "weak "
+			}
+		}
+		w.line(0, "import %s%s;", kind, protoQuote(dep))
+	}
+
+	if err := w.writeOptionStatements(0, fd.Options); err != nil {
+		return "", err
+	}
+
+	for _, m := range fd.MessageType {
+		if err := w.writeMessage(0, w.packagePrefix(), m); err != nil {
+			return "", err
+		}
+	}
+	for _, e := range fd.EnumType {
+		if err := w.writeEnum(0, e); err != nil {
+			return "", err
+		}
+	}
+	if err := w.writeExtends(0, fd.Extension); err != nil {
+		return "", err
+	}
+	for _, s := range fd.Service {
+		if err := w.writeService(s); err != nil {
+			return "", err
+		}
+	}
+
+	return w.b.String(), nil
+}
+
+func (w *descriptorSourceWriter) packagePrefix() string {
+	if w.fd.GetPackage() == "" {
+		return ""
+	}
+	return w.fd.GetPackage() + "."
+}
+
+func (w *descriptorSourceWriter) line(indent int, format string, args ...interface{}) {
+	w.b.WriteString(strings.Repeat("\t", indent))
+	fmt.Fprintf(&w.b, format, args...)
+	w.b.WriteString("\n")
+}
+
+// Returns the type name to use on the source. Types declared on the file itself are
+// written relative to the package, other types are written fully-qualified.
+func (w *descriptorSourceWriter) typeName(name string) string {
+	name = strings.TrimPrefix(name, ".")
+	if w.local[name] {
+		return strings.TrimPrefix(name, w.packagePrefix())
+	}
+	return name
+}
+
+func (w *descriptorSourceWriter) writeMessage(indent int, prefix string, m *descriptorpb.DescriptorProto) error {
+	fullName := prefix + m.GetName()
+
+	w.line(indent, "message %s {", m.GetName())
+
+	if err := w.writeOptionStatements(indent+1, m.Options); err != nil {
+		return err
+	}
+
+	// map entries are written as map fields
+	mapEntries := make(map[string]*descriptorpb.DescriptorProto)
+	for _, nm := range m.NestedType {
+		if nm.GetOptions().GetMapEntry() {
+			mapEntries["."+fullName+"."+nm.GetName()] = nm
+		}
+	}
+
+	writtenOneofs := make(map[int32]bool)
+	for _, fld := range m.Field {
+		if fld.OneofIndex != nil && !fld.GetProto3Optional() {
+			oi := fld.GetOneofIndex()
+			if writtenOneofs[oi] {
+				continue
+			}
+			writtenOneofs[oi] = true
+			if err := w.writeOneof(indent+1, m, oi); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if entry, ok := mapEntries[fld.GetTypeName()]; ok && fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED && len(entry.Field) == 2 {
+			opts, err := w.fieldOptions(fld)
+			if err != nil {
+				return err
+			}
+			w.line(indent+1, "map<%s, %s> %s = %d%s;", w.fieldType(entry.Field[0]), w.fieldType(entry.Field[1]),
+				fld.GetName(), fld.GetNumber(), opts)
+			continue
+		}
+
+		if err := w.writeField(indent+1, fld, true); err != nil {
+			return err
+		}
+	}
+
+	for _, nm := range m.NestedType {
+		if nm.GetOptions().GetMapEntry() {
+			continue
+		}
+		if err := w.writeMessage(indent+1, fullName+".", nm); err != nil {
+			return err
+		}
+	}
+	for _, e := range m.EnumType {
+		if err := w.writeEnum(indent+1, e); err != nil {
+			return err
+		}
+	}
+
+	for _, er := range m.ExtensionRange {
+		w.line(indent+1, "extensions %s;", descriptorRange(er.GetStart(), er.GetEnd()))
+	}
+	for _, rr := range m.ReservedRange {
+		w.line(indent+1, "reserved %s;", descriptorRange(rr.GetStart(), rr.GetEnd()))
+	}
+	if len(m.ReservedName) > 0 {
+		var names []string
+		for _, rn := range m.ReservedName {
+			names = append(names, protoQuote(rn))
+		}
+		w.line(indent+1, "reserved %s;", strings.Join(names, ", "))
+	}
+
+	if err := w.writeExtends(indent+1, m.Extension); err != nil {
+		return err
+	}
+
+	w.line(indent, "}")
+	return nil
+}
+
+func (w *descriptorSourceWriter) writeOneof(indent int, m *descriptorpb.DescriptorProto, index int32) error {
+	if int(index) >= len(m.OneofDecl) {
+		return fmt.Errorf("Invalid oneof index %d in message %s", index, m.GetName())
+	}
+	od := m.OneofDecl[index]
+
+	w.line(indent, "oneof %s {", od.GetName())
+	if err := w.writeOptionStatements(indent+1, od.Options); err != nil {
+		return err
+	}
+	for _, fld := range m.Field {
+		if fld.OneofIndex != nil && fld.GetOneofIndex() == index && !fld.GetProto3Optional() {
+			if err := w.writeField(indent+1, fld, false); err != nil {
+				return err
+			}
+		}
+	}
+	w.line(indent, "}")
+	return nil
+}
+
+// Writes a field. If withLabel is false, no label is written, as in oneof fields.
+func (w *descriptorSourceWriter) writeField(indent int, fld *descriptorpb.FieldDescriptorProto, withLabel bool) error {
+	// the parser doesn't support the group syntax, and writing it as a message field
+	// would change the wire format
+	if fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		return fmt.Errorf("Group field %s of file %s is not supported", fld.GetName(), w.fd.GetName())
+	}
+
+	label := ""
+	if withLabel {
+		switch {
+		case fld.GetProto3Optional():
+			label = "optional "
+		case fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+			label = "repeated "
+		case fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+			label = "required "
+		case w.fd.GetSyntax() != "proto3":
+			label = "optional "
+		}
+	}
+
+	opts, err := w.fieldOptions(fld)
+	if err != nil {
+		return err
+	}
+
+	w.line(indent, "%s%s %s = %d%s;", label, w.fieldType(fld), fld.GetName(), fld.GetNumber(), opts)
+	return nil
+}
+
+// Returns the type of the field as written on the source.
+func (w *descriptorSourceWriter) fieldType(fld *descriptorpb.FieldDescriptorProto) string {
+	switch fld.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return w.typeName(fld.GetTypeName())
+	}
+	if fld.Type == nil && fld.TypeName != nil {
+		return w.typeName(fld.GetTypeName())
+	}
+	return strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_"))
+}
+
+// Returns the bracketed options of a field, including the default value and json name.
+func (w *descriptorSourceWriter) fieldOptions(fld *descriptorpb.FieldDescriptorProto) (string, error) {
+	var opts []string
+	if fld.DefaultValue != nil {
+		switch fld.GetType() {
+		case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+			opts = append(opts, "default = "+protoQuote(fld.GetDefaultValue()))
+		case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+			// already C-escaped on the descriptor
+			opts = append(opts, `default = "`+fld.GetDefaultValue()+`"`)
+		default:
+			opts = append(opts, "default = "+fld.GetDefaultValue())
+		}
+	}
+	if fld.JsonName != nil && fld.GetJsonName() != jsonName(fld.GetName()) {
+		opts = append(opts, "json_name = "+protoQuote(fld.GetJsonName()))
+	}
+
+	o, err := w.options(fld.Options)
+	if err != nil {
+		return "", err
+	}
+	opts = append(opts, o...)
+
+	return bracketedOptions(opts), nil
+}
+
+func (w *descriptorSourceWriter) writeEnum(indent int, e *descriptorpb.EnumDescriptorProto) error {
+	w.line(indent, "enum %s {", e.GetName())
+	if err := w.writeOptionStatements(indent+1, e.Options); err != nil {
+		return err
+	}
+	for _, v := range e.Value {
+		opts, err := w.options(v.Options)
+		if err != nil {
+			return err
+		}
+		w.line(indent+1, "%s = %d%s;", v.GetName(), v.GetNumber(), bracketedOptions(opts))
+	}
+	for _, rr := range e.ReservedRange {
+		// enum reserved ranges are inclusive
+		w.line(indent+1, "reserved %s;", descriptorRange(rr.GetStart(), rr.GetEnd()+1))
+	}
+	w.line(indent, "}")
+	return nil
+}
+
+// Writes the extension fields, one extend block for each run of the same extendee.
+func (w *descriptorSourceWriter) writeExtends(indent int, fields []*descriptorpb.FieldDescriptorProto) error {
+	for i := 0; i < len(fields); {
+		extendee := fields[i].GetExtendee()
+		w.line(indent, "extend %s {", w.typeName(extendee))
+		for ; i < len(fields) && fields[i].GetExtendee() == extendee; i++ {
+			if err := w.writeField(indent+1, fields[i], true); err != nil {
+				return err
+			}
+		}
+		w.line(indent, "}")
+	}
+	return nil
+}
+
+func (w *descriptorSourceWriter) writeService(s *descriptorpb.ServiceDescriptorProto) error {
+	w.line(0, "service %s {", s.GetName())
+	if err := w.writeOptionStatements(1, s.Options); err != nil {
+		return err
+	}
+	for _, m := range s.Method {
+		req, resp := w.typeName(m.GetInputType()), w.typeName(m.GetOutputType())
+		if m.GetClientStreaming() {
+			req = "stream " + req
+		}
+		if m.GetServerStreaming() {
+			resp = "stream " + resp
+		}
+
+		opts, err := w.options(m.Options)
+		if err != nil {
+			return err
+		}
+		if len(opts) == 0 {
+			w.line(1, "rpc %s(%s) returns (%s);", m.GetName(), req, resp)
+			continue
+		}
+		w.line(1, "rpc %s(%s) returns (%s) {", m.GetName(), req, resp)
+		for _, o := range opts {
+			w.line(2, "option %s;", o)
+		}
+		w.line(1, "}")
+	}
+	w.line(0, "}")
+	return nil
+}
+
+func (w *descriptorSourceWriter) writeOptionStatements(indent int, msg proto.Message) error {
+	opts, err := w.options(msg)
+	if err != nil {
+		return err
+	}
+	for _, o := range opts {
+		w.line(indent, "option %s;", o)
+	}
+	return nil
+}
+
+// Returns the options set on the descriptor options message as "name = value" strings,
+// ordered by field number. Custom options are decoded using the extension types.
+func (w *descriptorSourceWriter) options(msg proto.Message) ([]string, error) {
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		return nil, nil
+	}
+
+	m := msg.ProtoReflect()
+	if w.types != nil && len(m.GetUnknown()) > 0 {
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		resolved := m.New()
+		if err := (proto.UnmarshalOptions{Resolver: w.types}).Unmarshal(data, resolved.Interface()); err != nil {
+			return nil, err
+		}
+		m = resolved
+	}
+
+	type optionField struct {
+		fd protoreflect.FieldDescriptor
+		v  protoreflect.Value
+	}
+	var fields []optionField
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		fields = append(fields, optionField{fd, v})
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].fd.Number() < fields[j].fd.Number()
+	})
+
+	var ret []string
+	for _, f := range fields {
+		if f.fd.Name() == "uninterpreted_option" && !f.fd.IsExtension() {
+			list := f.v.List()
+			for i := 0; i < list.Len(); i++ {
+				if uo, ok := list.Get(i).Message().Interface().(*descriptorpb.UninterpretedOption); ok {
+					ret = append(ret, uninterpretedOptionSource(uo))
+				}
+			}
+			continue
+		}
+
+		name := string(f.fd.Name())
+		if f.fd.IsExtension() {
+			name = "(" + string(f.fd.FullName()) + ")"
+		}
+
+		if f.fd.IsList() {
+			list := f.v.List()
+			for i := 0; i < list.Len(); i++ {
+				ret = append(ret, name+" = "+optionValueSource(f.fd, list.Get(i)))
+			}
+		} else {
+			ret = append(ret, name+" = "+optionValueSource(f.fd, f.v))
+		}
+	}
+	return ret, nil
+}
+
+// Returns an option value as written on the source.
+func optionValueSource(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoQuote(v.String())
+	case protoreflect.BytesKind:
+		return protoQuote(string(v.Bytes()))
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		f := v.Float()
+		switch {
+		case math.IsInf(f, 1):
+			return "inf"
+		case math.IsInf(f, -1):
+			return "-inf"
+		case math.IsNaN(f):
+			return "nan"
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "{ " + prototext.MarshalOptions{}.Format(v.Message().Interface()) + " }"
+	default:
+		return v.String()
+	}
+}
+
+// Returns an uninterpreted option as written on the source.
+func uninterpretedOptionSource(uo *descriptorpb.UninterpretedOption) string {
+	var name []string
+	for _, np := range uo.Name {
+		if np.GetIsExtension() {
+			name = append(name, "("+np.GetNamePart()+")")
+		} else {
+			name = append(name, np.GetNamePart())
+		}
+	}
+
+	var value string
+	switch {
+	case uo.IdentifierValue != nil:
+		value = uo.GetIdentifierValue()
+	case uo.PositiveIntValue != nil:
+		value = strconv.FormatUint(uo.GetPositiveIntValue(), 10)
+	case uo.NegativeIntValue != nil:
+		value = strconv.FormatInt(uo.GetNegativeIntValue(), 10)
+	case uo.DoubleValue != nil:
+		value = strconv.FormatFloat(uo.GetDoubleValue(), 'g', -1, 64)
+	case uo.AggregateValue != nil:
+		value = "{ " + uo.GetAggregateValue() + " }"
+	default:
+		value = protoQuote(string(uo.StringValue))
+	}
+
+	return strings.Join(name, ".") + " = " + value
+}
+
+// Returns a quoted string as written on the source, with the protobuf escapes, so strings
+// with non-ASCII and control characters are parsed back to the same bytes.
+func protoQuote(s string) string {
+	return `"` + protoEscape(s) + `"`
+}
+
+func bracketedOptions(opts []string) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(opts, ", ") + "]"
+}
+
+// Returns a descriptor range, whose end is exclusive, as written on the source.
+func descriptorRange(start, end int32) string {
+	if end >= descriptorMaxFieldNumber {
+		return fmt.Sprintf("%d to max", start)
+	} else if end-1 == start {
+		return strconv.Itoa(int(start))
+	}
+	return fmt.Sprintf("%d to %d", start, end-1)
+}
@@ -0,0 +1,169 @@
+package fdep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDepAddFileDescriptorSet(t *testing.T) {
+	src := NewDep()
+	addTestFiles(t, src, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+	})
+
+	fds, err := src.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	dep := NewDep()
+	err = dep.AddFileDescriptorSet(fds, DepType_Imported)
+	if err != nil {
+		t.Fatalf("Error adding file descriptor set: %v", err)
+	}
+
+	if !reflect.DeepEqual(dep.GetPackages(), src.GetPackages()) {
+		t.Fatalf("Packages should be %v, but are %v", src.GetPackages(), dep.GetPackages())
+	}
+
+	tp, err := dep.GetType("p_user.User.Address")
+	if err != nil || tp == nil {
+		t.Fatalf("Type p_user.User.Address should be found: %v", err)
+	}
+	if tp.DepFile.FilePath != "p_user/user.proto" || tp.DepFile.DepType != DepType_Imported {
+		t.Fatalf("Unexpected file of p_user.User.Address: %s", tp.DepFile.FilePath)
+	}
+
+	group, err := dep.GetType("p_descriptor.Group")
+	if err != nil || group == nil {
+		t.Fatalf("Type p_descriptor.Group should be found: %v", err)
+	}
+	refs, err := dep.GetTypeReferences("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type references: %v", err)
+	}
+	if len(refs) != 4 {
+		t.Fatalf("p_user.User should have 4 references, but has %d", len(refs))
+	}
+}
+
+func TestDepAddFileDescriptorSetRoundTrip(t *testing.T) {
+	src := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Own},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+	})
+
+	fds, err := src.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	dep := NewDep()
+	if err := dep.AddFileDescriptorSet(fds, DepType_Own); err != nil {
+		t.Fatalf("Error adding file descriptor set: %v", err)
+	}
+
+	fds2, err := dep.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	// options, including custom ones, must be preserved
+	if !proto.Equal(fds, fds2) {
+		t.Fatalf("File descriptor set should be\n%s\nbut is\n%s", prototext.Format(fds), prototext.Format(fds2))
+	}
+}
+
+func TestDepAddFileDescriptorSetEscape(t *testing.T) {
+	src := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Own},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+		{"p_escape/escape.proto", testfile_escape, DepType_Own},
+	})
+
+	fds, err := src.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	// the source is written with the protobuf escapes, like protoc does
+	source, err := descriptorSource(fds.File[2], descriptorExtensionTypes(fds.File))
+	if err != nil {
+		t.Fatalf("Error generating source: %v", err)
+	}
+	for _, s := range []string{
+		`default = "h\303\251llo \"w\303\266rld\"\n\001"`,
+		`(p_option.jsontag) = "t\303\241g\t\177"`,
+		`default = "\303\251\000\'\377"`,
+	} {
+		if !strings.Contains(source, s) {
+			t.Fatalf("Source should contain %s, but is\n%s", s, source)
+		}
+	}
+
+	dep := NewDep()
+	if err := dep.AddFileDescriptorSet(fds, DepType_Own); err != nil {
+		t.Fatalf("Error adding file descriptor set: %v", err)
+	}
+
+	fds2, err := dep.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	// non-ASCII and control characters of default values and options must be preserved
+	if !proto.Equal(fds, fds2) {
+		t.Fatalf("File descriptor set should be\n%s\nbut is\n%s", prototext.Format(fds), prototext.Format(fds2))
+	}
+	if v := fds2.File[2].MessageType[0].Field[0].GetDefaultValue(); v != "héllo \"wörld\"\n\x01" {
+		t.Fatalf("Unexpected string default value %q", v)
+	}
+}
+
+func TestDepAddFileDescriptorSetGroup(t *testing.T) {
+	fds := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			{
+				Name:    proto.String("p_group/group.proto"),
+				Package: proto.String("p_group"),
+				Syntax:  proto.String("proto2"),
+				MessageType: []*descriptorpb.DescriptorProto{
+					{
+						Name: proto.String("Search"),
+						Field: []*descriptorpb.FieldDescriptorProto{
+							{
+								Name:     proto.String("result"),
+								Number:   proto.Int32(1),
+								Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+								Type:     descriptorpb.FieldDescriptorProto_TYPE_GROUP.Enum(),
+								TypeName: proto.String(".p_group.Search.Result"),
+							},
+						},
+						NestedType: []*descriptorpb.DescriptorProto{
+							{Name: proto.String("Result")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	dep := NewDep()
+	err := dep.AddFileDescriptorSet(fds, DepType_Own)
+	if err == nil || !strings.Contains(err.Error(), "Group field result") {
+		t.Fatalf("Group fields should not be supported: %v", err)
+	}
+	if _, ok := dep.Files["p_group/group.proto"]; ok {
+		t.Fatalf("File with group fields should not be added")
+	}
+}
@@ -0,0 +1,149 @@
+package fdep
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// How the nodes of a file graph are clustered.
+type DotCluster int
+
+const (
+	// No clustering.
+	DotCluster_None DotCluster = iota
+
+	// One cluster for each package.
+	DotCluster_Package
+
+	// One cluster for each directory.
+	DotCluster_Directory
+)
+
+// Options of the file graph DOT export.
+type FileGraphOptions struct {
+	// How the files are clustered.
+	Cluster DotCluster
+
+	// If true, only files of type DepType_Own and their direct imports are written.
+	OnlyOwn bool
+}
+
+// Writes the file import graph in the Graphviz DOT format.
+// Own files are drawn as filled boxes, imported files as ellipses, and files that
+// were not found as dashed red boxes. Public imports are drawn as bold edges.
+func (d *Dep) WriteFileGraphDot(w io.Writer, options FileGraphOptions) error {
+	files := d.GetFiles()
+
+	// the files to write
+	nodes := make(map[string]*DepFile)
+	for _, df := range files {
+		if options.OnlyOwn && df.DepType != DepType_Own {
+			continue
+		}
+		nodes[df.FilePath] = df
+		if df.ProtoFile != nil {
+			for _, dep := range df.ProtoFile.Dependencies {
+				if _, ok := nodes[dep]; !ok {
+					nodes[dep] = d.GetFile(dep)
+				}
+			}
+		}
+	}
+
+	var node_paths []string
+	for fp := range nodes {
+		node_paths = append(node_paths, fp)
+	}
+	sort.Strings(node_paths)
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph files {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [fontname=\"Helvetica\"];")
+
+	// clusters
+	clusters := make(map[string][]string)
+	for _, fp := range node_paths {
+		key := ""
+		switch options.Cluster {
+		case DotCluster_Package:
+			if df := nodes[fp]; df != nil && df.ProtoFile != nil {
+				key = df.ProtoFile.PackageName
+			}
+		case DotCluster_Directory:
+			key = path.Dir(fp)
+		}
+		clusters[key] = append(clusters[key], fp)
+	}
+
+	var cluster_keys []string
+	for key := range clusters {
+		cluster_keys = append(cluster_keys, key)
+	}
+	sort.Strings(cluster_keys)
+
+	for ci, key := range cluster_keys {
+		indent := "\t"
+		if key != "" {
+			fmt.Fprintf(bw, "\tsubgraph cluster_%d {\n", ci)
+			fmt.Fprintf(bw, "\t\tlabel=%s;\n", dotQuote(key))
+			indent = "\t\t"
+		}
+		for _, fp := range clusters[key] {
+			fmt.Fprintf(bw, "%s%s [%s];\n", indent, dotQuote(fp), fileNodeAttributes(fp, nodes[fp]))
+		}
+		if key != "" {
+			fmt.Fprintln(bw, "\t}")
+		}
+	}
+
+	// edges
+	for _, fp := range node_paths {
+		df := nodes[fp]
+		if df == nil || df.ProtoFile == nil || (options.OnlyOwn && df.DepType != DepType_Own) {
+			continue
+		}
+
+		public := make(map[string]bool)
+		for _, pd := range df.ProtoFile.PublicDependencies {
+			public[pd] = true
+		}
+
+		for _, dep := range df.ProtoFile.Dependencies {
+			attrs := ""
+			if public[dep] {
+				attrs = " [style=bold, label=\"public\"]"
+			}
+			fmt.Fprintf(bw, "\t%s -> %s%s;\n", dotQuote(fp), dotQuote(dep), attrs)
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// Returns the DOT attributes of a file node.
+func fileNodeAttributes(filepath string, df *DepFile) string {
+	switch {
+	case df == nil || df.NotFound || df.ProtoFile == nil:
+		return fmt.Sprintf("label=%s, shape=box, style=dashed, color=red", dotQuote(filepath+"\n(not found)"))
+	case df.DepType == DepType_Own:
+		return "shape=box, style=filled, fillcolor=lightblue"
+	default:
+		return "shape=ellipse, color=gray40"
+	}
+}
+
+// Returns a quoted DOT identifier.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "\"" + s + "\""
+}
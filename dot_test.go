@@ -0,0 +1,38 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepFileGraphDot(t *testing.T) {
+	dep := NewDep()
+	dep.IgnoreNotFoundDependencies = true
+	addTestFiles(t, dep, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Imported},
+		{"p_c/c.proto", testfile_public_c, DepType_Imported},
+		{"p_b/b.proto", testfile_public_b, DepType_Own},
+		{"p_a/a.proto", testfile_public_a, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+	})
+
+	var out strings.Builder
+	err := dep.WriteFileGraphDot(&out, FileGraphOptions{Cluster: DotCluster_Package})
+	if err != nil {
+		t.Fatalf("Error writing file graph: %v", err)
+	}
+
+	for _, s := range []string{
+		`subgraph cluster_`,
+		`label="p_a";`,
+		`"p_a/a.proto" [shape=box, style=filled, fillcolor=lightblue];`,
+		`"p_d/d.proto" [shape=ellipse, color=gray40];`,
+		`"google/protobuf/empty.proto" [label="google/protobuf/empty.proto\n(not found)", shape=box, style=dashed, color=red];`,
+		`"p_a/a.proto" -> "p_b/b.proto";`,
+		`"p_b/b.proto" -> "p_c/c.proto" [style=bold, label="public"];`,
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("File graph should contain %s:\n%s", s, out.String())
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package fdep
+
+import (
+	"strings"
+
+	"github.com/RangelReale/fproto"
+)
+
+// The kind of a declared type. The kinds can be combined as a bitmask on TypeFilter.
+type TypeKind int
+
+const (
+	// A message, including nested messages.
+	TypeKind_Message TypeKind = 1 << iota
+
+	// An enum, including the ones nested in messages.
+	TypeKind_Enum
+
+	// A service.
+	TypeKind_Service
+
+	// An extend block, including the ones nested in messages.
+	TypeKind_Extend
+
+	// All kinds.
+	TypeKind_All = TypeKind_Message | TypeKind_Enum | TypeKind_Service | TypeKind_Extend
+)
+
+func (k TypeKind) String() string {
+	var ret []string
+	for _, kn := range []struct {
+		kind TypeKind
+		name string
+	}{
+		{TypeKind_Message, "MESSAGE"},
+		{TypeKind_Enum, "ENUM"},
+		{TypeKind_Service, "SERVICE"},
+		{TypeKind_Extend, "EXTEND"},
+	} {
+		if k&kn.kind != 0 {
+			ret = append(ret, kn.name)
+		}
+	}
+	if len(ret) == 0 {
+		return "UNKNOWN"
+	}
+	return strings.Join(ret, "|")
+}
+
+// Filters the types returned by the enumeration functions.
+type TypeFilter struct {
+	// The kinds of types to return. If zero, all kinds are returned.
+	Kinds TypeKind
+
+	// The types of the files to return types from. If empty, all files are used.
+	FileTypes []DepFileType
+}
+
+// Returns whether the filter accepts the file.
+func (f TypeFilter) matchFile(df *DepFile) bool {
+	if df.ProtoFile == nil {
+		return false
+	}
+	if len(f.FileTypes) == 0 {
+		return true
+	}
+	for _, ft := range f.FileTypes {
+		if ft == df.DepType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the filter accepts the kind.
+func (f TypeFilter) matchKind(kind TypeKind) bool {
+	return f.Kinds == 0 || f.Kinds&kind != 0
+}
+
+// Returns the kind of the type, or zero for scalars and oneofs.
+func (d *DepType) Kind() TypeKind {
+	switch xitem := d.Item.(type) {
+	case *fproto.MessageElement:
+		if xitem.IsExtend {
+			return TypeKind_Extend
+		}
+		return TypeKind_Message
+	case *fproto.EnumElement:
+		return TypeKind_Enum
+	case *fproto.ServiceElement:
+		return TypeKind_Service
+	}
+	return 0
+}
+
+// Returns all types of all files accepted by the filter, sorted by file path and then
+// in the order of DepFile.AllTypes. They are the canonical types of the symbol index.
+func (d *Dep) AllTypes(filter TypeFilter) []*DepType {
+	var ret []*DepType
+	for _, df := range d.GetFiles() {
+		ret = append(ret, df.AllTypes(filter)...)
+	}
+	return ret
+}
+
+// Calls "fn" for each type returned by AllTypes, until it returns false.
+func (d *Dep) RangeTypes(filter TypeFilter, fn func(t *DepType) bool) {
+	for _, t := range d.AllTypes(filter) {
+		if !fn(t) {
+			return
+		}
+	}
+}
+
+// Returns all types of the files of the package accepted by the filter, sorted by file
+// path and then in the order of DepFile.AllTypes.
+func (d *Dep) PackageTypes(pkg string, filter TypeFilter) []*DepType {
+	var ret []*DepType
+	for _, df := range d.GetFiles() {
+		if df.ProtoFile != nil && df.ProtoFile.PackageName == pkg {
+			ret = append(ret, df.AllTypes(filter)...)
+		}
+	}
+	return ret
+}
+
+// Returns all types of the file accepted by the filter: the top-level messages in
+// declaration order, each followed by its nested enums and messages, then the top-level
+// enums, the services and the extend blocks, including the ones nested in messages.
+func (df *DepFile) AllTypes(filter TypeFilter) []*DepType {
+	if !filter.matchFile(df) {
+		return nil
+	}
+
+	var ret []*DepType
+
+	df.Dep.mu.RLock()
+	for _, element := range symbolElements(df.ProtoFile) {
+		t, ok := df.Dep.symbolItems[element]
+		if !ok {
+			// file not on the dependency
+			t = NewDepTypeFromElement(df, element)
+		}
+		if filter.matchKind(t.Kind()) {
+			ret = append(ret, t)
+		}
+	}
+	if filter.matchKind(TypeKind_Extend) {
+		for _, m := range extendElements(df.ProtoFile) {
+			t, ok := df.Dep.symbolItems[m]
+			if !ok {
+				// file not on the dependency
+				t = NewDepTypeFromElement(df, m)
+			}
+			ret = append(ret, t)
+		}
+	}
+	df.Dep.mu.RUnlock()
+
+	return ret
+}
+
+// Calls "fn" for each type returned by AllTypes, until it returns false.
+func (df *DepFile) RangeTypes(filter TypeFilter, fn func(t *DepType) bool) {
+	for _, t := range df.AllTypes(filter) {
+		if !fn(t) {
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepAllTypes(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Imported},
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+	})
+
+	typeNames := func(types []*DepType) string {
+		var ret []string
+		for _, tp := range types {
+			ret = append(ret, tp.Kind().String()+":"+tp.FullOriginalName())
+		}
+		return strings.Join(ret, ",")
+	}
+
+	own := dep.AllTypes(TypeFilter{FileTypes: []DepFileType{DepType_Own}})
+	if n := typeNames(own); n != "MESSAGE:p_option.Tagged,EXTEND:p_option.google.protobuf.FieldOptions,"+
+		"MESSAGE:p_user.User,MESSAGE:p_user.User.Address,MESSAGE:p_user.UserListResponse,SERVICE:p_user.UserSvc" {
+		t.Fatalf("Unexpected own types: %s", n)
+	}
+
+	services := dep.AllTypes(TypeFilter{Kinds: TypeKind_Service})
+	if n := typeNames(services); n != "SERVICE:p_user.UserSvc" {
+		t.Fatalf("Unexpected services: %s", n)
+	}
+
+	pkg := dep.PackageTypes("google.protobuf", TypeFilter{Kinds: TypeKind_Message})
+	if n := typeNames(pkg); n != "MESSAGE:google.protobuf.FieldOptions,MESSAGE:google.protobuf.Empty" {
+		t.Fatalf("Unexpected google.protobuf messages: %s", n)
+	}
+
+	// messages are the canonical types
+	user, err := dep.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if own[2] != user {
+		t.Fatalf("Enumerated types should be the canonical types")
+	}
+
+	// extend blocks too
+	extends := dep.PackageTypes("p_option", TypeFilter{Kinds: TypeKind_Extend})
+	if len(extends) != 1 || extends[0] != own[1] ||
+		extends[0] != dep.DepTypeFromElement(dep.GetFile("p_option/option.proto").ProtoFile.ExtendMessages[0]) {
+		t.Fatalf("Enumerated extend blocks should be the canonical types")
+	}
+}
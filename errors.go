@@ -0,0 +1,73 @@
+package fdep
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error returned when an imported file is not found in any include directory.
+type DependencyNotFoundError struct {
+	// The file that contains the import. Can be blank if the file was added directly
+	// using AddIncludeFile.
+	FilePath string
+
+	// The imported file that was not found.
+	Dependency string
+}
+
+func (e *DependencyNotFoundError) Error() string {
+	if e.FilePath != "" {
+		return fmt.Sprintf("File %s imported by %s not found in include path", e.Dependency, e.FilePath)
+	}
+	return fmt.Sprintf("File %s not found in include path", e.Dependency)
+}
+
+// Error returned when the imports of the files form a cycle.
+type ImportCycleError struct {
+	// The files in the cycle, starting and ending with the same file.
+	Cycle []string
+}
+
+func (e *ImportCycleError) Error() string {
+	return fmt.Sprintf("Import cycle detected: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// A list of errors, returned by the loading functions when Dep.ContinueOnError is true.
+// The contained errors can be checked with errors.Is and errors.As.
+type MultiError struct {
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Returns the contained errors, for errors.Is and errors.As.
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// Appends an error to the list. The errors of a *MultiError are appended individually.
+func appendError(errs []error, err error) []error {
+	if merr, ok := err.(*MultiError); ok {
+		return append(errs, merr.Errors...)
+	}
+	return append(errs, err)
+}
+
+// Returns a *MultiError with the errors, or nil if the list is empty.
+// If there is only one error, it is returned as-is.
+func newMultiError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return &MultiError{Errors: errs}
+	}
+}
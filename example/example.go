@@ -101,7 +101,7 @@ func printExtensions(pdep *fdep.Dep) {
 // ==================== PRINT TYPES ====================
 // Type 'app.core.User' is in file 'app/core/user.proto', package 'app.core' [name: User]
 // Type 'app.core.SendMail.Body' is in file 'app/core/sendmail.proto', package 'app.core' [name: SendMail.Body, alias: app.core]
-// Type 'Body' in the context of 'app.core.SendMail' is in file 'app/core/sendmail.proto', package 'app.core' [name: SendMail.Body, alias: ]
+// Type 'Body' in the context of 'app.core.SendMail' is in file 'app/core/sendmail.proto', package 'app.core' [name: SendMail.Body, alias: app.core]
 func printTypes(pdep *fdep.Dep) {
 	fmt.Printf("%s PRINT TYPES %s\n", lines, lines)
 
@@ -140,7 +140,7 @@ func printTypes(pdep *fdep.Dep) {
 		log.Fatal(err)
 	}
 
-	// When getting a type in the context of other type, the alias may be blank if the type is on the same file.
+	// When getting a type in the context of other type, the same canonical type is returned, with the package as alias.
 	fmt.Printf("Type 'Body' in the context of 'app.core.SendMail' is in file '%s', package '%s' [name: %s, alias: %s]\n",
 		tp_sendmail_body2.DepFile.FilePath, tp_sendmail_body2.OriginalAlias, tp_sendmail_body2.Name, tp_sendmail_body2.Alias)
 }
@@ -0,0 +1,5 @@
+module github.com/RangelReale/fdep
+
+go 1.23
+
+require google.golang.org/protobuf v1.36.9
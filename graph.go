@@ -0,0 +1,204 @@
+package fdep
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A file that imports another file.
+type DepImporter struct {
+	// The importing file.
+	DepFile *DepFile
+
+	// Whether the file is imported using "import public". For indirect importers,
+	// whether there is a chain of public imports up to the file, meaning that the
+	// importer re-exports it.
+	Public bool
+}
+
+// Returns all files in topological order, each file after all files it imports.
+// The order is deterministic: root files are visited sorted by path, and the imports
+// in the order they are declared in the file.
+//
+// If there is an import cycle, an *ImportCycleError is returned.
+func (d *Dep) TopologicalOrder() ([]*DepFile, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.topologicalOrder(d.sortedFilePaths(), "")
+}
+
+// Like TopologicalOrder, but only returns the files of the passed type.
+func (d *Dep) TopologicalOrderOfType(deptype DepFileType) ([]*DepFile, error) {
+	files, err := d.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	return filterDepFiles(files, deptype), nil
+}
+
+// Returns all files the passed file imports, directly or indirectly, in topological order.
+// The file itself is not returned.
+//
+// If there is an import cycle, an *ImportCycleError is returned. An error is also returned
+// if the file is nil or is not one of the current files of this dependency.
+func (d *Dep) TransitiveDependencies(depfile *DepFile) ([]*DepFile, error) {
+	if depfile == nil {
+		return nil, fmt.Errorf("File is nil")
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.hasFile(depfile) {
+		return nil, fmt.Errorf("File %s is not on the dependency", depfile.FilePath)
+	}
+
+	return d.topologicalOrder([]string{depfile.FilePath}, depfile.FilePath)
+}
+
+// Like TransitiveDependencies, but only returns the files of the passed type.
+func (d *Dep) TransitiveDependenciesOfType(depfile *DepFile, deptype DepFileType) ([]*DepFile, error) {
+	files, err := d.TransitiveDependencies(depfile)
+	if err != nil {
+		return nil, err
+	}
+	return filterDepFiles(files, deptype), nil
+}
+
+// Returns the files that directly import the passed file, sorted by path.
+// Returns nil if the file is nil or is not on the dependency.
+func (d *Dep) GetImporters(depfile *DepFile) []*DepImporter {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.hasFile(depfile) {
+		return nil
+	}
+
+	var ret []*DepImporter
+	for importer, public := range d.importedBy[depfile.FilePath] {
+		if df, ok := d.Files[importer]; ok {
+			ret = append(ret, &DepImporter{DepFile: df, Public: public})
+		}
+	}
+	sortDepImporters(ret)
+	return ret
+}
+
+// Returns all files that import the passed file, directly or indirectly, sorted by path.
+// Returns nil if the file is nil or is not on the dependency.
+func (d *Dep) GetDependents(depfile *DepFile) []*DepImporter {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.hasFile(depfile) {
+		return nil
+	}
+
+	// files reachable using only public imports, and using any imports.
+	public := d.reverseReachable(depfile.FilePath, true)
+	all := d.reverseReachable(depfile.FilePath, false)
+
+	var ret []*DepImporter
+	for fp := range all {
+		if df, ok := d.Files[fp]; ok {
+			ret = append(ret, &DepImporter{DepFile: df, Public: public[fp]})
+		}
+	}
+	sortDepImporters(ret)
+	return ret
+}
+
+// Returns whether the file is the one on the dependency with its path.
+func (d *Dep) hasFile(depfile *DepFile) bool {
+	return depfile != nil && depfile.Dep == d && d.Files[depfile.FilePath] == depfile
+}
+
+// Returns the files that import the file, directly or indirectly, using the reverse
+// dependency index. If onlyPublic is true, only public imports are followed.
+func (d *Dep) reverseReachable(filepath string, onlyPublic bool) map[string]bool {
+	found := make(map[string]bool)
+	queue := []string{filepath}
+	for len(queue) > 0 {
+		fp := queue[0]
+		queue = queue[1:]
+		for importer, public := range d.importedBy[fp] {
+			if (public || !onlyPublic) && !found[importer] && importer != filepath {
+				found[importer] = true
+				queue = append(queue, importer)
+			}
+		}
+	}
+	return found
+}
+
+func sortDepImporters(list []*DepImporter) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].DepFile.FilePath < list[j].DepFile.FilePath
+	})
+}
+
+// Returns the files reachable from the roots in topological order, using a depth-first search.
+// The "exclude" file is not added to the result.
+func (d *Dep) topologicalOrder(roots []string, exclude string) ([]*DepFile, error) {
+	var ret []*DepFile
+
+	var stack []string
+	onstack := make(map[string]int)
+	done := make(map[string]bool)
+
+	var visit func(fp string) error
+	visit = func(fp string) error {
+		if idx, ok := onstack[fp]; ok {
+			cycle := append([]string{}, stack[idx:]...)
+			return &ImportCycleError{Cycle: append(cycle, fp)}
+		}
+		if done[fp] {
+			return nil
+		}
+
+		df, ok := d.Files[fp]
+		if !ok {
+			done[fp] = true
+			return nil
+		}
+
+		onstack[fp] = len(stack)
+		stack = append(stack, fp)
+		if df.ProtoFile != nil {
+			for _, fd := range df.ProtoFile.Dependencies {
+				if err := visit(fd); err != nil {
+					return err
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		delete(onstack, fp)
+		done[fp] = true
+
+		if fp != exclude {
+			ret = append(ret, df)
+		}
+		return nil
+	}
+
+	for _, root := range roots {
+		if err := visit(root); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// Returns only the files of the passed type.
+func filterDepFiles(files []*DepFile, deptype DepFileType) []*DepFile {
+	var ret []*DepFile
+	for _, df := range files {
+		if df.DepType == deptype {
+			ret = append(ret, df)
+		}
+	}
+	return ret
+}
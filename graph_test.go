@@ -0,0 +1,129 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepGraph(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Imported},
+		{"p_c/c.proto", testfile_public_c, DepType_Imported},
+		{"p_b/b.proto", testfile_public_b, DepType_Own},
+		{"p_a/a.proto", testfile_public_a, DepType_Own},
+	})
+
+	filePaths := func(files []*DepFile) string {
+		var ret []string
+		for _, df := range files {
+			ret = append(ret, df.FilePath)
+		}
+		return strings.Join(ret, ",")
+	}
+
+	order, err := dep.TopologicalOrder()
+	if err != nil {
+		t.Fatalf("Error getting topological order: %v", err)
+	}
+	if p := filePaths(order); p != "p_d/d.proto,p_c/c.proto,p_b/b.proto,p_a/a.proto" {
+		t.Fatalf("Unexpected topological order: %s", p)
+	}
+
+	order, err = dep.TopologicalOrderOfType(DepType_Own)
+	if err != nil {
+		t.Fatalf("Error getting topological order: %v", err)
+	}
+	if p := filePaths(order); p != "p_b/b.proto,p_a/a.proto" {
+		t.Fatalf("Unexpected topological order of own files: %s", p)
+	}
+
+	deps, err := dep.TransitiveDependencies(dep.Files["p_b/b.proto"])
+	if err != nil {
+		t.Fatalf("Error getting transitive dependencies: %v", err)
+	}
+	if p := filePaths(deps); p != "p_d/d.proto,p_c/c.proto" {
+		t.Fatalf("Unexpected transitive dependencies of b.proto: %s", p)
+	}
+
+	deps, err = dep.TransitiveDependenciesOfType(dep.Files["p_a/a.proto"], DepType_Imported)
+	if err != nil {
+		t.Fatalf("Error getting transitive dependencies: %v", err)
+	}
+	if p := filePaths(deps); p != "p_d/d.proto,p_c/c.proto" {
+		t.Fatalf("Unexpected imported transitive dependencies of a.proto: %s", p)
+	}
+
+	if _, err := dep.TransitiveDependencies(nil); err == nil {
+		t.Fatal("Transitive dependencies of a nil file should fail")
+	}
+	other := newTestDep(t, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+	})
+	if _, err := dep.TransitiveDependenciesOfType(other.Files["p_d/d.proto"], DepType_Own); err == nil {
+		t.Fatal("Transitive dependencies of a file of another dependency should fail")
+	}
+}
+
+func TestDepImporters(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+		{"p_c/c.proto", testfile_public_c, DepType_Own},
+		{"p_b/b.proto", testfile_public_b, DepType_Own},
+		{"p_a/a.proto", testfile_public_a, DepType_Own},
+	})
+
+	importers := func(list []*DepImporter) string {
+		var ret []string
+		for _, i := range list {
+			if i.Public {
+				ret = append(ret, i.DepFile.FilePath+"(public)")
+			} else {
+				ret = append(ret, i.DepFile.FilePath)
+			}
+		}
+		return strings.Join(ret, ",")
+	}
+
+	if i := importers(dep.GetImporters(dep.Files["p_c/c.proto"])); i != "p_b/b.proto(public)" {
+		t.Fatalf("Unexpected importers of c.proto: %s", i)
+	}
+
+	if i := importers(dep.GetImporters(dep.Files["p_b/b.proto"])); i != "p_a/a.proto" {
+		t.Fatalf("Unexpected importers of b.proto: %s", i)
+	}
+
+	if i := importers(dep.GetDependents(dep.Files["p_d/d.proto"])); i != "p_a/a.proto,p_b/b.proto(public),p_c/c.proto(public)" {
+		t.Fatalf("Unexpected dependents of d.proto: %s", i)
+	}
+
+	// nil files and files of another dependency have no importers
+	if dep.GetImporters(nil) != nil || dep.GetDependents(nil) != nil {
+		t.Fatal("A nil file should have no importers")
+	}
+	other := newTestDep(t, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+	})
+	if dep.GetImporters(other.Files["p_d/d.proto"]) != nil || dep.GetDependents(other.Files["p_d/d.proto"]) != nil {
+		t.Fatal("A file of another dependency should have no importers")
+	}
+}
+
+func TestDepImportersLiteral(t *testing.T) {
+	// a Dep created without NewDep must also build its indexes
+	dep := &Dep{
+		Files:      make(map[string]*DepFile),
+		Packages:   make(map[string][]string),
+		Extensions: make(map[string][]string),
+	}
+	addTestFiles(t, dep, []testFile{
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+		{"p_c/c.proto", testfile_public_c, DepType_Own},
+	})
+
+	if i := dep.GetImporters(dep.Files["p_d/d.proto"]); len(i) != 1 || i[0].DepFile.FilePath != "p_c/c.proto" {
+		t.Fatalf("Unexpected importers of d.proto: %v", i)
+	}
+	if syms := dep.LookupSymbol("p_d.D"); len(syms) != 1 {
+		t.Fatalf("Type p_d.D should be on the symbol index")
+	}
+}
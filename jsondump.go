@@ -0,0 +1,401 @@
+package fdep
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/RangelReale/fproto"
+)
+
+// The version of the JSON dump schema. It changes only on incompatible changes.
+const JSONDump_Version = 1
+
+// The JSON dump of a Dep.
+//
+// All lists are in a deterministic order: files, packages and extensions are sorted
+// by name, and the types, fields, values and methods of a file are in declaration
+// order, so snapshots of the same proto tree are always identical.
+type JSONDep struct {
+	// The schema version, JSONDump_Version.
+	Version int `json:"version"`
+
+	// All files, sorted by path.
+	Files []*JSONFile `json:"files"`
+
+	// All packages, sorted by name.
+	Packages []*JSONPackage `json:"packages"`
+
+	// All extended types, sorted by name.
+	Extensions []*JSONExtension `json:"extensions"`
+}
+
+// A file of the JSON dump.
+type JSONFile struct {
+	// The file path, as used on imports.
+	Path string `json:"path"`
+
+	// The DepFileType, "OWN" or "IMPORTED".
+	DepType string `json:"dep_type"`
+
+	// Whether the file was imported but not found. In this case only "path" and
+	// "dep_type" are set.
+	NotFound bool `json:"not_found,omitempty"`
+
+	// The proto package of the file.
+	Package string `json:"package,omitempty"`
+
+	// The imported files, in declaration order.
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// The publicly imported files, in declaration order.
+	PublicDependencies []string `json:"public_dependencies,omitempty"`
+
+	// All messages (including nested), enums, services and extend blocks of the file,
+	// in the order of DepFile.Walk. Nested types and extend blocks come after their parent.
+	Types []*JSONType `json:"types,omitempty"`
+}
+
+// A message, enum, service or extend block of the JSON dump.
+type JSONType struct {
+	// The element kind: "MESSAGE", "ENUM", "SERVICE" or "EXTEND".
+	Kind string `json:"kind"`
+
+	// The package of the type, the DepType OriginalAlias.
+	OriginalAlias string `json:"original_alias"`
+
+	// The name of the type inside the package, with the parent messages, like
+	// "User.Address". For extend blocks, the extended type name as written.
+	Name string `json:"name"`
+
+	// For extend blocks, the resolved extended type.
+	Extends *JSONTypeRef `json:"extends,omitempty"`
+
+	// The fields of messages and extend blocks.
+	Fields []*JSONField `json:"fields,omitempty"`
+
+	// The values of enums.
+	Values []*JSONEnumValue `json:"values,omitempty"`
+
+	// The methods of services.
+	Methods []*JSONMethod `json:"methods,omitempty"`
+}
+
+// A field of the JSON dump.
+type JSONField struct {
+	// The field name.
+	Name string `json:"name"`
+
+	// The field number.
+	Number int `json:"number"`
+
+	// The field label: "optional", "required", "repeated" or blank if not set.
+	Label string `json:"label,omitempty"`
+
+	// The field type, for maps the value type.
+	Type *JSONTypeRef `json:"type"`
+
+	// For maps, the key type.
+	KeyType *JSONTypeRef `json:"key_type,omitempty"`
+
+	// The name of the oneof that contains the field, if any.
+	OneOf string `json:"oneof,omitempty"`
+}
+
+// An enum value of the JSON dump.
+type JSONEnumValue struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// A service method of the JSON dump.
+type JSONMethod struct {
+	Name            string       `json:"name"`
+	RequestType     *JSONTypeRef `json:"request_type"`
+	StreamsRequest  bool         `json:"streams_request,omitempty"`
+	ResponseType    *JSONTypeRef `json:"response_type"`
+	StreamsResponse bool         `json:"streams_response,omitempty"`
+}
+
+// A type reference of the JSON dump, resolved the same way as DepType.GetTypes.
+type JSONTypeRef struct {
+	// The type name as written on the proto file.
+	Name string `json:"name"`
+
+	// The fully-qualified name of the resolved type, or the scalar name.
+	Resolved string `json:"resolved,omitempty"`
+
+	// The kind of the resolved type: "SCALAR", "MESSAGE" or "ENUM".
+	Kind string `json:"kind,omitempty"`
+
+	// The file of the resolved type, blank for scalars.
+	File string `json:"file,omitempty"`
+
+	// Set if the name could not be resolved: "not found", "ambiguous" or "not a message or enum".
+	Error string `json:"error,omitempty"`
+}
+
+// A package of the JSON dump.
+type JSONPackage struct {
+	Name string `json:"name"`
+
+	// The files of the package, sorted.
+	Files []string `json:"files"`
+}
+
+// An extended type of the JSON dump.
+type JSONExtension struct {
+	// The extended type name, as written on the extend blocks.
+	Name string `json:"name"`
+
+	// The packages that extend the type, sorted.
+	Packages []string `json:"packages"`
+}
+
+// Returns the JSON dump of the dependency.
+func (d *Dep) JSONDump() (*JSONDep, error) {
+	ret := &JSONDep{
+		Version:    JSONDump_Version,
+		Files:      []*JSONFile{},
+		Packages:   []*JSONPackage{},
+		Extensions: []*JSONExtension{},
+	}
+
+	for _, df := range d.GetFiles() {
+		jf, err := df.jsonDump()
+		if err != nil {
+			return nil, err
+		}
+		ret.Files = append(ret.Files, jf)
+	}
+
+	for _, pkg := range d.GetPackages() {
+		ret.Packages = append(ret.Packages, &JSONPackage{
+			Name:  pkg,
+			Files: d.GetPackageFiles(pkg),
+		})
+	}
+
+	d.mu.RLock()
+	for name, pkgs := range d.Extensions {
+		ext := &JSONExtension{
+			Name:     name,
+			Packages: append([]string(nil), pkgs...),
+		}
+		sort.Strings(ext.Packages)
+		ret.Extensions = append(ret.Extensions, ext)
+	}
+	d.mu.RUnlock()
+	sort.Slice(ret.Extensions, func(i, j int) bool {
+		return ret.Extensions[i].Name < ret.Extensions[j].Name
+	})
+
+	return ret, nil
+}
+
+// Writes the JSON dump of the dependency, indented.
+func (d *Dep) WriteJSONDump(w io.Writer) error {
+	dump, err := d.JSONDump()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+func (df *DepFile) jsonDump() (*JSONFile, error) {
+	ret := &JSONFile{
+		Path:     df.FilePath,
+		DepType:  df.DepType.String(),
+		NotFound: df.NotFound || df.ProtoFile == nil,
+	}
+	if ret.NotFound {
+		return ret, nil
+	}
+
+	ret.Package = df.ProtoFile.PackageName
+	ret.Dependencies = df.ProtoFile.Dependencies
+	ret.PublicDependencies = df.ProtoFile.PublicDependencies
+
+	// the names are resolved by the visitor, to dump the ones that are not found
+	v := &jsonDumpVisitor{depfile: df, types: make(map[fproto.FProtoElement]*JSONType)}
+	if err := df.walk(v, false); err != nil {
+		return nil, err
+	}
+	ret.Types = v.ret
+
+	return ret, nil
+}
+
+// A Visitor that builds the JSON types of a file.
+type jsonDumpVisitor struct {
+	BaseVisitor
+	depfile *DepFile
+	ret     []*JSONType
+
+	// the JSON types by element, to add their children
+	types map[fproto.FProtoElement]*JSONType
+
+	// the oneof names of the fields declared inside oneofs
+	oneofs map[*fproto.FieldElement]string
+}
+
+func (v *jsonDumpVisitor) addType(t *DepType, jt *JSONType) {
+	v.ret = append(v.ret, jt)
+	v.types[t.Item] = jt
+}
+
+func (v *jsonDumpVisitor) VisitMessage(message *DepType) error {
+	v.addType(message, &JSONType{
+		Kind:          "MESSAGE",
+		OriginalAlias: message.OriginalAlias,
+		Name:          message.Name,
+	})
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitField(owner *DepType, fld *fproto.FieldElement, fieldType *DepType) error {
+	t, err := jsonDumpTypeRef(v.depfile, fieldScope(owner), fld.Type)
+	if err != nil {
+		return err
+	}
+	jf := &JSONField{
+		Name:   fld.Name,
+		Number: fld.Tag,
+		Type:   t,
+		Label:  fieldElementLabel(fld).String(),
+		OneOf:  v.oneofs[fld],
+	}
+	jt := v.types[owner.Item]
+	jt.Fields = append(jt.Fields, jf)
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitMapField(owner *DepType, fld *fproto.MapFieldElement, keyType *DepType, valueType *DepType) error {
+	if err := v.VisitField(owner, fld.FieldElement, valueType); err != nil {
+		return err
+	}
+	jt := v.types[owner.Item]
+	kt, err := jsonDumpTypeRef(v.depfile, fieldScope(owner), fld.KeyType)
+	if err != nil {
+		return err
+	}
+	jt.Fields[len(jt.Fields)-1].KeyType = kt
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitOneOf(owner *DepType, oneof *fproto.OneOfFieldElement) error {
+	if v.oneofs == nil {
+		v.oneofs = make(map[*fproto.FieldElement]string)
+	}
+	for _, fld := range oneof.Fields {
+		if xfld, ok := fld.(*fproto.FieldElement); ok {
+			v.oneofs[xfld] = oneof.Name
+		}
+	}
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitEnum(enum *DepType) error {
+	v.addType(enum, &JSONType{
+		Kind:          "ENUM",
+		OriginalAlias: enum.OriginalAlias,
+		Name:          enum.Name,
+	})
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitEnumValue(enum *DepType, value *fproto.EnumConstantElement) error {
+	jt := v.types[enum.Item]
+	jt.Values = append(jt.Values, &JSONEnumValue{
+		Name:   value.Name,
+		Number: value.Tag,
+	})
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitService(service *DepType) error {
+	v.addType(service, &JSONType{
+		Kind:          "SERVICE",
+		OriginalAlias: service.OriginalAlias,
+		Name:          service.Name,
+	})
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitMethod(service *DepType, rpc *fproto.RPCElement, requestType *DepType, responseType *DepType) error {
+	req, err := jsonDumpTypeRef(v.depfile, nil, rpc.RequestType)
+	if err != nil {
+		return err
+	}
+	resp, err := jsonDumpTypeRef(v.depfile, nil, rpc.ResponseType)
+	if err != nil {
+		return err
+	}
+	jt := v.types[service.Item]
+	jt.Methods = append(jt.Methods, &JSONMethod{
+		Name:            rpc.Name,
+		RequestType:     req,
+		StreamsRequest:  rpc.StreamsRequest,
+		ResponseType:    resp,
+		StreamsResponse: rpc.StreamsResponse,
+	})
+	return nil
+}
+
+func (v *jsonDumpVisitor) VisitExtend(extend *DepType, extendedType *DepType) error {
+	m := extend.Item.(*fproto.MessageElement)
+	extends, err := jsonDumpTypeRef(v.depfile, extendScope(v.depfile, m), m.Name)
+	if err != nil {
+		return err
+	}
+	v.addType(extend, &JSONType{
+		Kind:          "EXTEND",
+		OriginalAlias: v.depfile.OriginalAlias(),
+		Name:          m.Name,
+		Extends:       extends,
+	})
+	return nil
+}
+
+// Resolves a type name in the scope, or in the file scope if nil.
+func jsonDumpTypeRef(df *DepFile, scope *DepType, name string) (*JSONTypeRef, error) {
+	var t []*DepType
+	var err error
+	if scope != nil {
+		t, err = scope.GetTypes(name)
+	} else {
+		t, err = df.GetTypes(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &JSONTypeRef{
+		Name: name,
+	}
+	switch {
+	case len(t) == 0:
+		ret.Error = "not found"
+	case len(t) > 1:
+		ret.Error = "ambiguous"
+	case t[0].IsScalar():
+		ret.Resolved = t[0].ScalarType.ProtoType()
+		ret.Kind = "SCALAR"
+	default:
+		switch t[0].Item.(type) {
+		case *fproto.MessageElement:
+			ret.Kind = "MESSAGE"
+		case *fproto.EnumElement:
+			ret.Kind = "ENUM"
+		default:
+			ret.Error = "not a message or enum"
+			return ret, nil
+		}
+		ret.Resolved = df.Dep.elementType(t[0].DepFile, t[0].Item).FullOriginalName()
+		ret.File = t[0].DepFile.FilePath
+	}
+	return ret, nil
+}
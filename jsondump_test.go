@@ -0,0 +1,71 @@
+package fdep
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDepJSONDump(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+	})
+
+	dump, err := dep.JSONDump()
+	if err != nil {
+		t.Fatalf("Error dumping: %v", err)
+	}
+
+	if len(dump.Files) != 3 || dump.Files[1].Path != "p_descriptor/descriptor.proto" {
+		t.Fatalf("Dump should have 3 files sorted by path")
+	}
+
+	group := dump.Files[1].Types[0]
+	if group.Kind != "MESSAGE" || group.Name != "Group" || len(group.Fields) != 4 {
+		t.Fatalf("Unexpected Group dump: %+v", group)
+	}
+	if f := group.Fields[1]; f.KeyType == nil || f.KeyType.Resolved != "string" || f.Type.Resolved != "p_user.User" ||
+		f.Type.File != "p_user/user.proto" {
+		t.Fatalf("Unexpected map field dump: %+v", f)
+	}
+	if f := group.Fields[2]; f.OneOf != "owner" {
+		t.Fatalf("Field user should be on oneof owner, but is on '%s'", f.OneOf)
+	}
+
+	// snapshots must be identical
+	var out1, out2 bytes.Buffer
+	if err = dep.WriteJSONDump(&out1); err != nil {
+		t.Fatalf("Error writing dump: %v", err)
+	}
+	if err = dep.WriteJSONDump(&out2); err != nil {
+		t.Fatalf("Error writing dump: %v", err)
+	}
+	if out1.String() != out2.String() {
+		t.Fatalf("JSON dumps should be identical")
+	}
+}
+
+func TestDepJSONDumpNestedExtend(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_nested/nested.proto", testfile_nested_extend, DepType_Own},
+	})
+
+	dump, err := dep.JSONDump()
+	if err != nil {
+		t.Fatalf("Error dumping: %v", err)
+	}
+
+	types := dump.Files[1].Types
+	if len(types) != 3 || types[0].Name != "Outer" || types[1].Name != "Outer.Inner" || types[2].Kind != "EXTEND" {
+		t.Fatalf("Unexpected nested.proto types: %+v", types)
+	}
+
+	// the names of the extend block are resolved in the message scope
+	ext := types[2]
+	if ext.Extends.Resolved != "google.protobuf.FieldOptions" || len(ext.Fields) != 1 ||
+		ext.Fields[0].Type.Resolved != "p_nested.Outer.Inner" {
+		t.Fatalf("Unexpected extend block dump: %+v", ext)
+	}
+}
@@ -0,0 +1,151 @@
+package fdep
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RangelReale/fproto"
+)
+
+// The kind of a problem found by Link.
+type LinkProblemKind int
+
+const (
+	// The type name was not found.
+	LinkProblem_Unresolved LinkProblemKind = iota
+
+	// The type name resolves to more than one type.
+	LinkProblem_Ambiguous
+)
+
+func (k LinkProblemKind) String() string {
+	switch k {
+	case LinkProblem_Unresolved:
+		return "UNRESOLVED"
+	case LinkProblem_Ambiguous:
+		return "AMBIGUOUS"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// A type reference that could not be resolved by Link.
+type LinkProblem struct {
+	// The kind of the problem.
+	Kind LinkProblemKind
+
+	// The type name as written on the proto file.
+	TypeName string
+
+	// The kind of the reference.
+	ReferenceKind TypeReferenceKind
+
+	// The file of the referencing element.
+	DepFile *DepFile
+
+	// The message, extend block or service that contains the referencing element.
+	Owner *DepType
+
+	// The referencing element, like in TypeReference.Element.
+	Element fproto.FProtoElement
+
+	// The types found, if ambiguous.
+	Candidates []*DepType
+}
+
+func (p *LinkProblem) String() string {
+	switch p.Kind {
+	case LinkProblem_Ambiguous:
+		var candidates []string
+		for _, c := range p.Candidates {
+			candidates = append(candidates, c.FullOriginalName())
+		}
+		return fmt.Sprintf("%s: %s: type '%s' is ambiguous [%s]", p.DepFile.FilePath, p.location(), p.TypeName,
+			strings.Join(candidates, ", "))
+	default:
+		return fmt.Sprintf("%s: %s: type '%s' not found", p.DepFile.FilePath, p.location(), p.TypeName)
+	}
+}
+
+// Returns a description of the location of the reference, like "field 'name' of 'pkg.Message'".
+func (p *LinkProblem) location() string {
+	desc := "element"
+	switch p.ReferenceKind {
+	case TypeReference_Field, TypeReference_MapKey, TypeReference_MapValue, TypeReference_OneOfField:
+		desc = "field"
+	case TypeReference_RPCRequest, TypeReference_RPCResponse:
+		desc = "rpc"
+	case TypeReference_Extend:
+		return fmt.Sprintf("extend '%s'", p.TypeName)
+	}
+	return fmt.Sprintf("%s '%s' of '%s'", desc, p.Element.ElementName(), p.Owner.FullOriginalName())
+}
+
+// Error returned by Link, with all problems found.
+type LinkError struct {
+	Problems []*LinkProblem
+}
+
+func (e *LinkError) Error() string {
+	var problems []string
+	for _, p := range e.Problems {
+		problems = append(problems, p.String())
+	}
+	return fmt.Sprintf("%d type references could not be resolved:\n%s", len(e.Problems), strings.Join(problems, "\n"))
+}
+
+// Returns the problems of the passed kind.
+func (e *LinkError) ProblemsOfKind(kind LinkProblemKind) []*LinkProblem {
+	var ret []*LinkProblem
+	for _, p := range e.Problems {
+		if p.Kind == kind {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// Resolves all type references of the DepType_Own files: fields, map keys and values,
+// oneof fields, rpc requests and responses, and extend blocks.
+//
+// If any reference can't be resolved or is ambiguous, returns a *LinkError with all
+// the problems found. The files are checked sorted by path, and the references in the
+// order they are declared.
+func (d *Dep) Link() error {
+	var problems []*LinkProblem
+
+	for _, df := range d.GetFiles() {
+		if df.DepType != DepType_Own {
+			continue
+		}
+
+		for _, ref := range df.typeNameReferences() {
+			t, err := ref.resolve()
+			if err != nil {
+				return err
+			}
+			if len(t) == 1 {
+				continue
+			}
+
+			p := &LinkProblem{
+				Kind:          LinkProblem_Unresolved,
+				TypeName:      ref.name,
+				ReferenceKind: ref.kind,
+				DepFile:       ref.depfile,
+				Owner:         ref.owner,
+				Element:       ref.element,
+			}
+			if len(t) > 1 {
+				p.Kind = LinkProblem_Ambiguous
+				p.Candidates = t
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &LinkError{Problems: problems}
+	}
+	return nil
+}
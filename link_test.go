@@ -0,0 +1,39 @@
+package fdep
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDepLink(t *testing.T) {
+	dep := NewDep()
+	err := dep.AddReader("p_link/link.proto", strings.NewReader(testfile_link), DepType_Own)
+	if err != nil {
+		t.Fatalf("Error parsing link proto: %v", err)
+	}
+
+	err = dep.Link()
+	if err == nil {
+		t.Fatalf("Link should fail with unresolved types")
+	}
+
+	var linkerr *LinkError
+	if !errors.As(err, &linkerr) {
+		t.Fatalf("Error should be a *LinkError, but is %T: %v", err, err)
+	}
+
+	unresolved := linkerr.ProblemsOfKind(LinkProblem_Unresolved)
+	if len(unresolved) != 2 {
+		t.Fatalf("Link should find 2 unresolved types, but found %d: %v", len(unresolved), err)
+	}
+
+	if unresolved[0].TypeName != "Customer" || unresolved[0].ReferenceKind != TypeReference_Field ||
+		unresolved[0].Owner.FullOriginalName() != "p_link.Order" {
+		t.Fatalf("Unexpected first unresolved type: %s", unresolved[0].String())
+	}
+
+	if unresolved[1].TypeName != "OrderResponse" || unresolved[1].ReferenceKind != TypeReference_RPCResponse {
+		t.Fatalf("Unexpected second unresolved type: %s", unresolved[1].String())
+	}
+}
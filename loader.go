@@ -0,0 +1,163 @@
+package fdep
+
+import (
+	"io/fs"
+	"path"
+	"sync"
+
+	"github.com/RangelReale/fproto"
+)
+
+// A directory added using the AddPath functions.
+type pathRoot struct {
+	currentpath string
+	fsys        fs.FS
+	dir         string
+	deptype     DepFileType
+}
+
+// A file found by walkPathFS, or an error reading a directory.
+type pathFile struct {
+	// The internal path of the file.
+	filepath string
+
+	fsys     fs.FS
+	filename string
+
+	// Error reading the directory. If set, "filepath" is the internal path of the
+	// directory, and the other fields are blank.
+	dirErr error
+
+	// Parse result, valid after "parsed" is closed.
+	pfile    *fproto.ProtoFile
+	parseErr error
+	parsed   chan struct{}
+
+	deptype DepFileType
+}
+
+// Returns all .proto files of a directory recursively, in the order the AddPath functions add them.
+// Paths on the ignore list are skipped. The list is passed because the directory is read without
+// holding the lock.
+func walkPathFS(ignoreFilePaths []string, currentpath string, fsys fs.FS, dir string) []*pathFile {
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return []*pathFile{{filepath: currentpath, dirErr: err}}
+	}
+
+	var ret []*pathFile
+	for _, f := range files {
+		if f.IsDir() {
+			ret = append(ret, walkPathFS(ignoreFilePaths, path.Join(currentpath, f.Name()), fsys, path.Join(dir, f.Name()))...)
+		} else if path.Ext(f.Name()) == ".proto" && !isIgnoredPath(ignoreFilePaths, currentpath) {
+			ret = append(ret, &pathFile{
+				filepath: path.Join(currentpath, f.Name()),
+				fsys:     fsys,
+				filename: path.Join(dir, f.Name()),
+				parsed:   make(chan struct{}),
+			})
+		}
+	}
+	return ret
+}
+
+// Parses the files using ParseWorkers goroutines, and adds them to the dependency in order
+// as soon as each one is parsed. A file imported by a previous one is added when the
+// importer is, using the same parse result.
+func (d *Dep) addPathFiles(files []*pathFile, deptype DepFileType) error {
+	workers := d.ParseWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	d.mu.Lock()
+	if d.pathFiles == nil {
+		d.pathFiles = make(map[string]*pathFile)
+	}
+	for _, pf := range files {
+		if pf.dirErr == nil {
+			pf.deptype = deptype
+			d.pathFiles[pf.filepath] = pf
+		}
+	}
+	d.mu.Unlock()
+
+	jobs := make(chan *pathFile)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pf := range jobs {
+				pf.pfile, pf.parseErr = d.parseFileFS(pf.filepath, pf.fsys, pf.filename)
+				close(pf.parsed)
+			}
+		}()
+	}
+
+	// send the files to the workers in order, until all are sent or loading stops
+	go func() {
+		defer close(jobs)
+		for _, pf := range files {
+			if pf.dirErr != nil {
+				continue
+			}
+			select {
+			case jobs <- pf:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		d.mu.Lock()
+		for _, pf := range files {
+			if d.pathFiles[pf.filepath] == pf {
+				delete(d.pathFiles, pf.filepath)
+			}
+		}
+		d.mu.Unlock()
+
+		close(stop)
+		wg.Wait()
+	}()
+
+	var errs []error
+	for _, pf := range files {
+		err := pf.dirErr
+		if err == nil {
+			<-pf.parsed
+			err = pf.parseErr
+		}
+		if err == nil {
+			d.mu.Lock()
+			// skipped if it was already added as an import of a previous file
+			if df, ok := d.Files[pf.filepath]; !ok || df.ProtoFile != pf.pfile {
+				err = d.addProtoFile(pf.filepath, pf.pfile, deptype, &fileSource{fsys: pf.fsys, filename: pf.filename})
+			}
+			d.mu.Unlock()
+		}
+
+		if err != nil {
+			if !d.ContinueOnError {
+				return err
+			}
+			errs = appendError(errs, err)
+		}
+	}
+
+	return newMultiError(errs)
+}
+
+// Adds a file being added by the AddPath functions as an import of another file, waiting
+// for the workers to parse it.
+func (d *Dep) addParsedPathFile(pf *pathFile) error {
+	<-pf.parsed
+	if pf.parseErr != nil {
+		return pf.parseErr
+	}
+	return d.addProtoFile(pf.filepath, pf.pfile, pf.deptype, &fileSource{fsys: pf.fsys, filename: pf.filename})
+}
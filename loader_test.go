@@ -0,0 +1,136 @@
+package fdep
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDepContinueOnError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/p_invalid/invalid.proto":       {Data: []byte(testfile_invalid)},
+		"app/p_link/link.proto":             {Data: []byte(testfile_link)},
+		"app/myapp/proto/p_user/user.proto": {Data: []byte(testfile_user)},
+	}
+
+	dep := NewDep()
+	dep.ContinueOnError = true
+	err := dep.AddPathFS(fsys, "app", DepType_Own)
+	if err == nil {
+		t.Fatalf("Adding path should fail")
+	}
+
+	var merr *MultiError
+	if !errors.As(err, &merr) {
+		t.Fatalf("Error should be a *MultiError, but is %T: %v", err, err)
+	}
+
+	if len(merr.Errors) != 2 {
+		t.Fatalf("Should have 2 errors, but have %d: %v", len(merr.Errors), err)
+	}
+
+	var nferr *DependencyNotFoundError
+	if !errors.As(err, &nferr) || nferr.Dependency != "google/protobuf/empty.proto" {
+		t.Fatalf("Errors should contain a *DependencyNotFoundError for google/protobuf/empty.proto: %v", err)
+	}
+
+	if _, ok := dep.Files["p_link/link.proto"]; !ok {
+		t.Fatalf("Valid file p_link/link.proto should have been loaded")
+	}
+
+	// the file with the missing import is not added
+	if dep.GetFile("myapp/proto/p_user/user.proto") != nil {
+		t.Fatalf("File myapp/proto/p_user/user.proto should not have been added")
+	}
+	if tp, _ := dep.FindType("p_user.User"); tp != nil {
+		t.Fatalf("Type p_user.User should not be found")
+	}
+}
+
+func TestDepParseWorkers(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/myapp/proto/p_user/user.proto":   {Data: []byte(testfile_user)},
+		"app/p_a/a.proto":                     {Data: []byte(testfile_public_a)},
+		"app/p_b/b.proto":                     {Data: []byte(testfile_public_b)},
+		"app/p_c/c.proto":                     {Data: []byte(testfile_public_c)},
+		"app/p_d/d.proto":                     {Data: []byte(testfile_public_d)},
+		"app/p_link/link.proto":               {Data: []byte(testfile_link)},
+		"include/google/protobuf/empty.proto": {Data: []byte(testfile_google_empty)},
+	}
+
+	load := func(workers int) *Dep {
+		dep := NewDep()
+		dep.ParseWorkers = workers
+		if err := dep.AddIncludeDirFS(fsys, "include"); err != nil {
+			t.Fatalf("Error adding include dir: %v", err)
+		}
+		if err := dep.AddPathFS(fsys, "app", DepType_Own); err != nil {
+			t.Fatalf("Error adding path with %d workers: %v", workers, err)
+		}
+		return dep
+	}
+
+	serial := load(0)
+	parallel := load(4)
+
+	if !reflect.DeepEqual(serial.sortedFilePaths(), parallel.sortedFilePaths()) {
+		t.Fatalf("Files are different: %v != %v", serial.sortedFilePaths(), parallel.sortedFilePaths())
+	}
+
+	if !reflect.DeepEqual(serial.Packages, parallel.Packages) {
+		t.Fatalf("Packages are different: %v != %v", serial.Packages, parallel.Packages)
+	}
+
+	if !reflect.DeepEqual(serial.Extensions, parallel.Extensions) {
+		t.Fatalf("Extensions are different: %v != %v", serial.Extensions, parallel.Extensions)
+	}
+
+	for filepath, df := range serial.Files {
+		if df.DepType != parallel.Files[filepath].DepType {
+			t.Fatalf("File %s type is different", filepath)
+		}
+	}
+}
+
+// A filesystem that counts the opened .proto files, to count the parses.
+type openCountingFS struct {
+	fstest.MapFS
+	opens int32
+}
+
+func (f *openCountingFS) Open(name string) (fs.File, error) {
+	if path.Ext(name) == ".proto" {
+		atomic.AddInt32(&f.opens, 1)
+	}
+	return f.MapFS.Open(name)
+}
+
+func TestDepParseWorkersParseOnce(t *testing.T) {
+	// each file imports the next one, so all but the last are imported before they are reached
+	files := fstest.MapFS{
+		"app/p_a/a.proto": {Data: []byte(testfile_public_a)},
+		"app/p_b/b.proto": {Data: []byte(testfile_public_b)},
+		"app/p_c/c.proto": {Data: []byte(testfile_public_c)},
+		"app/p_d/d.proto": {Data: []byte(testfile_public_d)},
+	}
+
+	for _, workers := range []int{0, 4} {
+		fsys := &openCountingFS{MapFS: files}
+		dep := NewDep()
+		dep.ParseWorkers = workers
+		if err := dep.AddPathFS(fsys, "app", DepType_Own); err != nil {
+			t.Fatalf("Error adding path with %d workers: %v", workers, err)
+		}
+
+		if fsys.opens != 4 {
+			t.Fatalf("Each file should be parsed once with %d workers, but got %d parses", workers, fsys.opens)
+		}
+		if len(dep.Files) != 4 || dep.Files["p_d/d.proto"].DepType != DepType_Own {
+			t.Fatalf("All files should be added as own files with %d workers", workers)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package fdep
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	gofilepath "path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/RangelReale/fproto"
+)
+
+// A cache of parsed files, keyed by a hash of the file content.
+// Set it on Dep.ParseCache to avoid parsing unchanged files again.
+// Implementations must be safe for concurrent use, and must return a new
+// *fproto.ProtoFile on each Get, as the result is added to the Dep.
+type ParseCache interface {
+	// Returns the parsed file for the key, if available.
+	Get(key string) (*fproto.ProtoFile, bool)
+
+	// Stores the parsed file for the key. The error is ignored by the Dep, and the file is
+	// parsed again on the next load.
+	Put(key string, pfile *fproto.ProtoFile) error
+}
+
+// Version of the cache format, part of the cache key.
+const parseCacheVersion = "fdep-parse-cache-2"
+
+// Fingerprint of the layout of the fproto types stored on the cache, part of the cache key,
+// so entries written using another fproto version are never used.
+// It is blank if the types can't be stored without losing information, and in this case
+// the cache is not used.
+var parseCacheSchema = parseCacheFingerprint()
+
+// Returns the cache key of a file content, for the schema fingerprint.
+func parseCacheKey(schema string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(parseCacheVersion))
+	h.Write([]byte{0})
+	h.Write([]byte(schema))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// The concrete fproto types stored on the cache. The types found on interfaces
+// other than the Parent fields must be listed here, they are registered on gob
+// and their layout is part of the fingerprint.
+var parseCacheTypes = []interface{}{
+	&fproto.ProtoFile{},
+	&fproto.FieldElement{},
+	&fproto.MapFieldElement{},
+	&fproto.OneOfFieldElement{},
+}
+
+// Returns the fingerprint of the layout of the types stored on the cache, with the names
+// and types of all fields of the structs reachable from them, including the listed
+// implementations of the interfaces.
+// Returns blank if any struct has unexported fields, fields that gob can't encode, or
+// interfaces without a listed implementation.
+func parseCacheFingerprint() string {
+	var b strings.Builder
+	ok := true
+	seen := make(map[reflect.Type]bool)
+
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			walk(t.Elem())
+		case reflect.Map:
+			walk(t.Key())
+			walk(t.Elem())
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			ok = false
+		case reflect.Interface:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+
+			fmt.Fprintf(&b, "%s.%s(", t.PkgPath(), t.Name())
+			var impls []reflect.Type
+			for _, v := range parseCacheTypes {
+				if it := reflect.TypeOf(v); it.Implements(t) {
+					fmt.Fprintf(&b, "%s;", it.String())
+					impls = append(impls, it)
+				}
+			}
+			b.WriteString(")")
+			if len(impls) == 0 {
+				ok = false
+			}
+
+			for _, it := range impls {
+				walk(it)
+			}
+		case reflect.Struct:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+
+			fmt.Fprintf(&b, "%s.%s{", t.PkgPath(), t.Name())
+			for i := 0; i < t.NumField(); i++ {
+				sf := t.Field(i)
+				if !sf.IsExported() {
+					ok = false
+				}
+				fmt.Fprintf(&b, "%s %s;", sf.Name, sf.Type.String())
+			}
+			b.WriteString("}")
+
+			for i := 0; i < t.NumField(); i++ {
+				// the Parent fields are not stored
+				if sf := t.Field(i); sf.Name != "Parent" || sf.Type != protoElementType {
+					walk(sf.Type)
+				}
+			}
+		}
+	}
+
+	for _, v := range parseCacheTypes {
+		walk(reflect.TypeOf(v))
+	}
+
+	if !ok {
+		return ""
+	}
+	return b.String()
+}
+
+// A ParseCache that stores the parsed files on a directory of the filesystem,
+// one file per content hash. As the key is the content hash, a changed file
+// automatically uses a new cache entry.
+type DirParseCache struct {
+	dir string
+}
+
+// Creates a DirParseCache on the directory, creating it if needed.
+func NewDirParseCache(dir string) (*DirParseCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating cache directory %s: %v", dir, err)
+	}
+	return &DirParseCache{dir: dir}, nil
+}
+
+func (c *DirParseCache) Get(key string) (*fproto.ProtoFile, bool) {
+	data, err := os.ReadFile(c.entryPath(key))
+	if err != nil {
+		return nil, false
+	}
+
+	pfile, err := decodeProtoFile(data)
+	if err != nil {
+		return nil, false
+	}
+	return pfile, true
+}
+
+func (c *DirParseCache) Put(key string, pfile *fproto.ProtoFile) error {
+	data, err := encodeProtoFile(pfile)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file and rename, so readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.entryPath(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Removes all cache entries.
+func (c *DirParseCache) Clear() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && (gofilepath.Ext(e.Name()) == ".gob" || strings.HasPrefix(e.Name(), "tmp-")) {
+			if err := os.Remove(gofilepath.Join(c.dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *DirParseCache) entryPath(key string) string {
+	return gofilepath.Join(c.dir, key+".gob")
+}
+
+func init() {
+	// registered before any entry is encoded or decoded, so entries written by
+	// another process can be read
+	for _, v := range parseCacheTypes {
+		gob.Register(v)
+	}
+}
+
+var protoElementType = reflect.TypeOf((*fproto.FProtoElement)(nil)).Elem()
+
+// Encodes a parsed file. As the elements point to their parents, a copy without
+// the Parent fields is encoded, and the links are rebuilt when decoding.
+func encodeProtoFile(pfile *fproto.ProtoFile) ([]byte, error) {
+	clone := cloneWithoutParents(reflect.ValueOf(pfile), make(map[uintptr]reflect.Value))
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(clone.Interface()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decodes a parsed file encoded by encodeProtoFile.
+func decodeProtoFile(data []byte) (*fproto.ProtoFile, error) {
+	var pfile *fproto.ProtoFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&pfile); err != nil {
+		return nil, err
+	}
+	if pfile == nil {
+		return nil, fmt.Errorf("Empty cache entry")
+	}
+
+	linkParents(reflect.ValueOf(pfile), reflect.Value{}, make(map[uintptr]bool))
+	return pfile, nil
+}
+
+// Returns a deep copy of the value, with all Parent fields of the elements cleared.
+func cloneWithoutParents(v reflect.Value, seen map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		if c, ok := seen[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		seen[v.Pointer()] = c
+		c.Elem().Set(cloneWithoutParents(v.Elem(), seen))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		elem := v.Elem()
+		c := reflect.New(v.Type()).Elem()
+		c.Set(cloneWithoutParents(elem, seen))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(cloneWithoutParents(v.Index(i), seen))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), cloneWithoutParents(iter.Value(), seen))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if !sf.IsExported() || (sf.Name == "Parent" && sf.Type == protoElementType) {
+				continue
+			}
+			c.Field(i).Set(cloneWithoutParents(v.Field(i), seen))
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// Sets the Parent fields of the elements reachable from v. "parent" is the element
+// that contains v, or invalid for the root.
+func linkParents(v reflect.Value, parent reflect.Value, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		if v.Type().Implements(protoElementType) {
+			linkStructParents(v.Elem(), v, parent, seen)
+		} else {
+			linkStructParents(v.Elem(), parent, parent, seen)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			linkParents(v.Elem(), parent, seen)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			linkParents(v.Index(i), parent, seen)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			linkParents(iter.Value(), parent, seen)
+		}
+	case reflect.Struct:
+		if v.CanSet() {
+			linkStructParents(v, parent, parent, seen)
+		}
+	}
+}
+
+// Sets the Parent fields of a struct and its children. "self" is the element the struct
+// belongs to, and "parent" its parent element. Embedded structs are part of the same element.
+func linkStructParents(s reflect.Value, self reflect.Value, parent reflect.Value, seen map[uintptr]bool) {
+	for i := 0; i < s.NumField(); i++ {
+		sf := s.Type().Field(i)
+		f := s.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		if sf.Name == "Parent" && sf.Type == protoElementType {
+			if parent.IsValid() {
+				f.Set(parent)
+			}
+			continue
+		}
+
+		if sf.Anonymous && f.Kind() == reflect.Ptr && !f.IsNil() && f.Elem().Kind() == reflect.Struct {
+			linkStructParents(f.Elem(), self, parent, seen)
+			continue
+		}
+
+		linkParents(f, self, seen)
+	}
+}
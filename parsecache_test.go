@@ -0,0 +1,139 @@
+package fdep
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/RangelReale/fproto"
+)
+
+func TestDepParseCache(t *testing.T) {
+	dir, err := NewDirParseCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error creating parse cache: %v", err)
+	}
+	cache := &countingParseCache{ParseCache: dir}
+
+	// the second load must use the cached files, and give the same result
+	for i := 0; i < 2; i++ {
+		dep := NewDep()
+		dep.ParseCache = cache
+		addTestFiles(t, dep, []testFile{
+			{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+			{"myapp/proto/p_user/user.proto", testfile_user, DepType_Own},
+		})
+
+		// files are only parsed, and so stored, on the first load
+		if cache.hits != i*2 || cache.puts != 2 {
+			t.Fatalf("Load %d: expected %d cache hits and 2 stored files, got %d and %d", i, i*2, cache.hits, cache.puts)
+		}
+
+		user_address_type, err := dep.GetType("p_user.User.Address")
+		if err != nil {
+			t.Fatalf("Error getting type p_user.User.Address: %v", err)
+		}
+
+		if user_address_type.Name != "User.Address" || user_address_type.Parent().Name != "User" {
+			t.Fatalf("Unexpected p_user.User.Address type: %s", user_address_type.FullOriginalName())
+		}
+
+		if df := dep.DepFileFromElement(user_address_type.Item); df == nil || df.FilePath != "myapp/proto/p_user/user.proto" {
+			t.Fatalf("Element parents should lead to user.proto")
+		}
+	}
+
+	if err := dir.Clear(); err != nil {
+		t.Fatalf("Error clearing parse cache: %v", err)
+	}
+}
+
+// A ParseCache that counts the cache hits and the stored files.
+type countingParseCache struct {
+	ParseCache
+	hits, puts int
+}
+
+func (c *countingParseCache) Get(key string) (*fproto.ProtoFile, bool) {
+	pfile, ok := c.ParseCache.Get(key)
+	if ok {
+		c.hits++
+	}
+	return pfile, ok
+}
+
+func (c *countingParseCache) Put(key string, pfile *fproto.ProtoFile) error {
+	c.puts++
+	return c.ParseCache.Put(key, pfile)
+}
+
+// A ParseCache that fails to store files, and counts the reads.
+type failingParseCache struct {
+	gets int
+}
+
+func (c *failingParseCache) Get(key string) (*fproto.ProtoFile, bool) {
+	c.gets++
+	return nil, false
+}
+
+func (c *failingParseCache) Put(key string, pfile *fproto.ProtoFile) error {
+	return errors.New("cache is read-only")
+}
+
+func TestDepParseCacheErrors(t *testing.T) {
+	if parseCacheSchema == "" {
+		t.Fatalf("The fproto types should be cacheable")
+	}
+
+	// the implementations stored on the field interfaces are part of the fingerprint
+	if !strings.Contains(parseCacheSchema, "fproto.FieldElementTag(*fproto.FieldElement;*fproto.MapFieldElement;*fproto.OneOfFieldElement;)") {
+		t.Fatalf("The fingerprint should include the field implementations: %s", parseCacheSchema)
+	}
+
+	// entries of other fproto versions are never used
+	data := []byte(testfile_google_empty)
+	if parseCacheKey(parseCacheSchema, data) == parseCacheKey(parseCacheSchema+"X int;", data) {
+		t.Fatalf("The cache key should depend on the fproto types")
+	}
+
+	// corrupt entries are misses
+	dir, err := NewDirParseCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error creating parse cache: %v", err)
+	}
+	key := parseCacheKey(parseCacheSchema, data)
+	if err := os.WriteFile(dir.entryPath(key), []byte("corrupt"), 0644); err != nil {
+		t.Fatalf("Error writing cache entry: %v", err)
+	}
+	if _, ok := dir.Get(key); ok {
+		t.Fatalf("A corrupt cache entry should be a miss")
+	}
+
+	// errors storing on the cache don't make loading fail
+	cache := &failingParseCache{}
+	dep := NewDep()
+	dep.ParseCache = cache
+	if err := dep.AddReader("google/protobuf/empty.proto", strings.NewReader(testfile_google_empty), DepType_Own); err != nil {
+		t.Fatalf("Error storing on the cache should be ignored, but got %v", err)
+	}
+	if cache.gets != 1 || dep.GetFile("google/protobuf/empty.proto") == nil {
+		t.Fatalf("The file should be parsed and added")
+	}
+
+	// the cache is bypassed if the fproto types can't be stored
+	schema := parseCacheSchema
+	parseCacheSchema = ""
+	defer func() { parseCacheSchema = schema }()
+
+	cache = &failingParseCache{}
+	dep = NewDep()
+	dep.ParseCache = cache
+	if err := dep.AddReader("google/protobuf/empty.proto", strings.NewReader(testfile_google_empty), DepType_Own); err != nil {
+		t.Fatalf("Uncacheable fproto types should not make loading fail, but got %v", err)
+	}
+	if cache.gets != 0 {
+		t.Fatalf("The cache should not be used for uncacheable fproto types")
+	}
+}
@@ -0,0 +1,156 @@
+package fdep
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// The request received by a protoc plugin.
+type PluginRequest struct {
+	// The dependency with all files sent by protoc. The files to generate are
+	// DepType_Own, and all others are DepType_Imported.
+	Dep *Dep
+
+	// The files to generate, in the order requested by protoc.
+	FilesToGenerate []*DepFile
+
+	// The raw parameter string, like "paths=source_relative,plugins=grpc".
+	Parameter string
+
+	// The parameters parsed using ParsePluginParameter.
+	Parameters map[string]string
+
+	// The original request.
+	Request *pluginpb.CodeGeneratorRequest
+}
+
+// A file generated by a protoc plugin.
+type PluginFile struct {
+	// The file name, relative to the output directory.
+	Name string
+
+	// If set, the content is inserted on this insertion point of the file.
+	InsertionPoint string
+
+	// The file content.
+	Content string
+}
+
+// The generator function of a protoc plugin.
+type PluginGenerator func(req *PluginRequest) ([]*PluginFile, error)
+
+// Runs a protoc plugin, reading the request from stdin and writing the response to stdout.
+// Ex:
+//
+//	func main() {
+//		err := fdep.RunPlugin(generate)
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+func RunPlugin(gen PluginGenerator) error {
+	return RunPluginIO(os.Stdin, os.Stdout, gen)
+}
+
+// Runs a protoc plugin, reading the CodeGeneratorRequest from r and writing the
+// CodeGeneratorResponse to w.
+// Errors from loading the files or from the generator are sent to protoc on the
+// response, only errors reading or writing are returned.
+func RunPluginIO(r io.Reader, w io.Writer, gen PluginGenerator) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("Error reading plugin request: %w", err)
+	}
+
+	req := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		return fmt.Errorf("Error reading plugin request: %w", err)
+	}
+
+	// proto3 optional fields are loaded from the descriptors like any other optional field
+	resp := &pluginpb.CodeGeneratorResponse{
+		SupportedFeatures: proto.Uint64(uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)),
+	}
+
+	files, err := runPluginRequest(req, gen)
+	if err != nil {
+		resp.Error = proto.String(err.Error())
+	}
+	for _, f := range files {
+		rf := &pluginpb.CodeGeneratorResponse_File{
+			Name:    proto.String(f.Name),
+			Content: proto.String(f.Content),
+		}
+		if f.InsertionPoint != "" {
+			rf.InsertionPoint = proto.String(f.InsertionPoint)
+		}
+		resp.File = append(resp.File, rf)
+	}
+
+	data, err = proto.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("Error writing plugin response: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("Error writing plugin response: %w", err)
+	}
+	return nil
+}
+
+// Builds the dependency from the request and runs the generator.
+func runPluginRequest(req *pluginpb.CodeGeneratorRequest, gen PluginGenerator) ([]*PluginFile, error) {
+	generate := make(map[string]bool)
+	for _, f := range req.FileToGenerate {
+		generate[f] = true
+	}
+
+	dep := NewDep()
+	err := dep.addFileDescriptors(req.ProtoFile, func(filepath string) DepFileType {
+		if generate[filepath] {
+			return DepType_Own
+		}
+		return DepType_Imported
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	preq := &PluginRequest{
+		Dep:        dep,
+		Parameter:  req.GetParameter(),
+		Parameters: ParsePluginParameter(req.GetParameter()),
+		Request:    req,
+	}
+	for _, f := range req.FileToGenerate {
+		df := dep.GetFile(f)
+		if df == nil {
+			return nil, fmt.Errorf("File to generate %s was not sent by protoc", f)
+		}
+		preq.FilesToGenerate = append(preq.FilesToGenerate, df)
+	}
+
+	return gen(preq)
+}
+
+// Parses a plugin parameter string in the "key=value,flag" format.
+// Parameters without a value are returned with a blank value.
+func ParsePluginParameter(parameter string) map[string]string {
+	ret := make(map[string]string)
+	for _, p := range strings.Split(parameter, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if i := strings.Index(p, "="); i >= 0 {
+			ret[p[:i]] = p[i+1:]
+		} else {
+			ret[p] = ""
+		}
+	}
+	return ret
+}
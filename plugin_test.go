@@ -0,0 +1,63 @@
+package fdep
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func TestDepPlugin(t *testing.T) {
+	src := NewDep()
+	addTestFiles(t, src, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+	})
+
+	fds, err := src.FileDescriptorSet()
+	if err != nil {
+		t.Fatalf("Error exporting file descriptor set: %v", err)
+	}
+
+	req, err := proto.Marshal(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{"p_user/user.proto"},
+		Parameter:      proto.String("paths=source_relative,debug"),
+		ProtoFile:      fds.File,
+	})
+	if err != nil {
+		t.Fatalf("Error creating plugin request: %v", err)
+	}
+
+	var out bytes.Buffer
+	err = RunPluginIO(bytes.NewReader(req), &out, func(req *PluginRequest) ([]*PluginFile, error) {
+		if len(req.FilesToGenerate) != 1 || req.FilesToGenerate[0].DepType != DepType_Own {
+			return nil, fmt.Errorf("Unexpected files to generate")
+		}
+		if req.Dep.GetFile("google/protobuf/empty.proto").DepType != DepType_Imported {
+			return nil, fmt.Errorf("Dependencies should be imported")
+		}
+		if p, ok := req.Parameters["debug"]; req.Parameters["paths"] != "source_relative" || !ok || p != "" {
+			return nil, fmt.Errorf("Unexpected parameters: %v", req.Parameters)
+		}
+		return []*PluginFile{{Name: "p_user/user.txt", Content: req.FilesToGenerate[0].ProtoFile.PackageName}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Error running plugin: %v", err)
+	}
+
+	resp := &pluginpb.CodeGeneratorResponse{}
+	if err = proto.Unmarshal(out.Bytes(), resp); err != nil {
+		t.Fatalf("Error reading plugin response: %v", err)
+	}
+	if resp.Error != nil {
+		t.Fatalf("Plugin returned an error: %s", resp.GetError())
+	}
+	if resp.GetSupportedFeatures()&uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL) == 0 {
+		t.Fatalf("Plugin should support proto3 optional fields")
+	}
+	if len(resp.File) != 1 || resp.File[0].GetName() != "p_user/user.txt" || resp.File[0].GetContent() != "p_user" {
+		t.Fatalf("Unexpected plugin response: %v", resp)
+	}
+}
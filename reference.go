@@ -0,0 +1,230 @@
+package fdep
+
+import "github.com/RangelReale/fproto"
+
+// The kind of a type reference.
+type TypeReferenceKind int
+
+const (
+	// The type of a field of a message or extend block.
+	TypeReference_Field TypeReferenceKind = iota
+
+	// The key type of a map field.
+	TypeReference_MapKey
+
+	// The value type of a map field.
+	TypeReference_MapValue
+
+	// The type of a field inside a oneof.
+	TypeReference_OneOfField
+
+	// The request type of a RPC.
+	TypeReference_RPCRequest
+
+	// The response type of a RPC.
+	TypeReference_RPCResponse
+
+	// The type extended by an extend block.
+	TypeReference_Extend
+)
+
+func (k TypeReferenceKind) String() string {
+	switch k {
+	case TypeReference_Field:
+		return "FIELD"
+	case TypeReference_MapKey:
+		return "MAP_KEY"
+	case TypeReference_MapValue:
+		return "MAP_VALUE"
+	case TypeReference_OneOfField:
+		return "ONEOF_FIELD"
+	case TypeReference_RPCRequest:
+		return "RPC_REQUEST"
+	case TypeReference_RPCResponse:
+		return "RPC_RESPONSE"
+	case TypeReference_Extend:
+		return "EXTEND"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// A reference to a type from an element of a proto file.
+type TypeReference struct {
+	// The kind of the reference.
+	Kind TypeReferenceKind
+
+	// The referenced type.
+	Type *DepType
+
+	// The type name as written on the proto file.
+	TypeName string
+
+	// The file of the referencing element.
+	DepFile *DepFile
+
+	// The message, extend block or service that contains the referencing element.
+	// For TypeReference_Extend, it is the extend block itself.
+	Owner *DepType
+
+	// The referencing element. Can be a *fproto.FieldElement, *fproto.MapFieldElement,
+	// *fproto.RPCElement, or the *fproto.MessageElement of the extend block.
+	Element fproto.FProtoElement
+}
+
+// Returns all references to the type with the passed name, from all files.
+// The name is resolved using GetType.
+func (d *Dep) GetTypeReferences(name string) ([]*TypeReference, error) {
+	t, err := d.GetType(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.getTypeReferences(t)
+}
+
+// Returns all references to this type, from all files of the dependency.
+// Always returns nil for scalars, as they don't have a dependency.
+func (d *DepType) GetReferences() ([]*TypeReference, error) {
+	if d.DepFile == nil {
+		return nil, nil
+	}
+	return d.DepFile.Dep.getTypeReferences(d)
+}
+
+func (d *Dep) getTypeReferences(t *DepType) ([]*TypeReference, error) {
+	d.refsMu.Lock()
+	defer d.refsMu.Unlock()
+
+	d.mu.RLock()
+	generation := d.generation
+	d.mu.RUnlock()
+
+	if d.typeReferences == nil || d.typeReferencesGeneration != generation {
+		idx, err := d.buildTypeReferences()
+		if err != nil {
+			return nil, err
+		}
+		d.typeReferences = idx
+		d.typeReferencesGeneration = generation
+	}
+
+	return d.typeReferences[typeReferenceKey(t)], nil
+}
+
+// Builds the type reference index from all files. Names that are not found or are
+// ambiguous are not added to the index.
+// The lock must NOT be held, as the names are resolved using the public methods.
+func (d *Dep) buildTypeReferences() (map[interface{}][]*TypeReference, error) {
+	ret := make(map[interface{}][]*TypeReference)
+	for _, df := range d.GetFiles() {
+		for _, ref := range df.typeNameReferences() {
+			t, err := ref.resolve()
+			if err != nil {
+				return nil, err
+			}
+			if len(t) != 1 {
+				continue
+			}
+
+			key := typeReferenceKey(t[0])
+			ret[key] = append(ret[key], &TypeReference{
+				Kind:     ref.kind,
+				Type:     t[0],
+				TypeName: ref.name,
+				DepFile:  ref.depfile,
+				Owner:    ref.owner,
+				Element:  ref.element,
+			})
+		}
+	}
+	return ret, nil
+}
+
+// The key of a type on the type reference index.
+func typeReferenceKey(t *DepType) interface{} {
+	if t.IsScalar() {
+		return *t.ScalarType
+	}
+	return t.Item
+}
+
+// A type name referenced from an element of a file, not yet resolved.
+type typeNameReference struct {
+	kind    TypeReferenceKind
+	name    string
+	depfile *DepFile
+
+	// The type in which scope the name must be resolved, or nil for the file scope.
+	scope *DepType
+
+	owner   *DepType
+	element fproto.FProtoElement
+}
+
+// Resolves the type name in its scope.
+func (r *typeNameReference) resolve() ([]*DepType, error) {
+	if r.scope != nil {
+		return r.scope.GetTypes(r.name)
+	}
+	return r.depfile.GetTypes(r.name)
+}
+
+// Returns all type names referenced from the file, in the order of DepFile.Walk.
+func (df *DepFile) typeNameReferences() []*typeNameReference {
+	c := &typeNameCollector{depfile: df, oneofFields: make(map[*fproto.FieldElement]bool)}
+	// the types are not resolved, so the walk doesn't fail
+	_ = df.walk(c, false)
+	return c.refs
+}
+
+// A Visitor that collects the type names referenced from a file, not yet resolved.
+type typeNameCollector struct {
+	BaseVisitor
+	depfile *DepFile
+	refs    []*typeNameReference
+
+	// the fields declared inside oneofs
+	oneofFields map[*fproto.FieldElement]bool
+}
+
+func (c *typeNameCollector) add(kind TypeReferenceKind, name string, scope *DepType, owner *DepType, element fproto.FProtoElement) {
+	c.refs = append(c.refs, &typeNameReference{kind: kind, name: name, depfile: c.depfile, scope: scope, owner: owner, element: element})
+}
+
+func (c *typeNameCollector) VisitField(owner *DepType, fld *fproto.FieldElement, fieldType *DepType) error {
+	kind := TypeReference_Field
+	if c.oneofFields[fld] {
+		kind = TypeReference_OneOfField
+	}
+	c.add(kind, fld.Type, fieldScope(owner), owner, fld)
+	return nil
+}
+
+func (c *typeNameCollector) VisitMapField(owner *DepType, fld *fproto.MapFieldElement, keyType *DepType, valueType *DepType) error {
+	scope := fieldScope(owner)
+	c.add(TypeReference_MapKey, fld.KeyType, scope, owner, fld)
+	c.add(TypeReference_MapValue, fld.Type, scope, owner, fld)
+	return nil
+}
+
+func (c *typeNameCollector) VisitOneOf(owner *DepType, oneof *fproto.OneOfFieldElement) error {
+	for _, fld := range oneof.Fields {
+		if xfld, ok := fld.(*fproto.FieldElement); ok {
+			c.oneofFields[xfld] = true
+		}
+	}
+	return nil
+}
+
+func (c *typeNameCollector) VisitMethod(service *DepType, rpc *fproto.RPCElement, requestType *DepType, responseType *DepType) error {
+	c.add(TypeReference_RPCRequest, rpc.RequestType, nil, service, rpc)
+	c.add(TypeReference_RPCResponse, rpc.ResponseType, nil, service, rpc)
+	return nil
+}
+
+func (c *typeNameCollector) VisitExtend(extend *DepType, extendedType *DepType) error {
+	// the name of the extended type is resolved in the scope where the block is declared
+	m := extend.Item.(*fproto.MessageElement)
+	c.add(TypeReference_Extend, m.Name, extendScope(c.depfile, m), extend, m)
+	return nil
+}
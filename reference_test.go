@@ -0,0 +1,72 @@
+package fdep
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDepTypeReferences(t *testing.T) {
+	dep := NewDep()
+	dep.IgnoreNotFoundDependencies = true
+	addTestFiles(t, dep, []testFile{
+		{"myapp/proto/p_user/user.proto", testfile_user, DepType_Own},
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Imported},
+	})
+
+	refs, err := dep.GetTypeReferences("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting references of p_user.User: %v", err)
+	}
+
+	var refdesc []string
+	for _, ref := range refs {
+		refdesc = append(refdesc, fmt.Sprintf("%s:%s:%s", ref.Kind.String(), ref.Owner.FullOriginalName(), ref.Element.ElementName()))
+	}
+
+	if r := strings.Join(refdesc, ","); r != "FIELD:p_user.UserListResponse:list,RPC_REQUEST:p_user.UserSvc:Add" {
+		t.Fatalf("Unexpected references of p_user.User: %s", r)
+	}
+
+	empty_type, err := dep.GetType("google.protobuf.Empty")
+	if err != nil {
+		t.Fatalf("Error getting type google.protobuf.Empty: %v", err)
+	}
+
+	refs, err = empty_type.GetReferences()
+	if err != nil {
+		t.Fatalf("Error getting references of google.protobuf.Empty: %v", err)
+	}
+
+	if len(refs) != 2 {
+		t.Fatalf("google.protobuf.Empty should have 2 references, but has %d", len(refs))
+	}
+}
+
+func TestDepTypeReferencesNestedExtend(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_nested/nested.proto", testfile_nested_extend, DepType_Own},
+	})
+
+	refs, err := dep.GetTypeReferences("p_nested.Outer.Inner")
+	if err != nil {
+		t.Fatalf("Error getting references of p_nested.Outer.Inner: %v", err)
+	}
+
+	var refdesc []string
+	for _, ref := range refs {
+		refdesc = append(refdesc, fmt.Sprintf("%s:%s", ref.Kind.String(), ref.Element.ElementName()))
+	}
+	if r := strings.Join(refdesc, ","); r != "FIELD:inner,FIELD:inner_option" {
+		t.Fatalf("Unexpected references of p_nested.Outer.Inner: %s", r)
+	}
+
+	refs, err = dep.GetTypeReferences("google.protobuf.FieldOptions")
+	if err != nil {
+		t.Fatalf("Error getting references of google.protobuf.FieldOptions: %v", err)
+	}
+	if len(refs) != 1 || refs[0].Kind != TypeReference_Extend {
+		t.Fatalf("google.protobuf.FieldOptions should be referenced by the extend block")
+	}
+}
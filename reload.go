@@ -0,0 +1,155 @@
+package fdep
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/RangelReale/fproto"
+)
+
+// The filesystem location a file was read from.
+type fileSource struct {
+	fsys     fs.FS
+	filename string
+}
+
+// Removes a file from the dependency, updating all indexes.
+//
+// If the file is still imported by other files, it is kept as a not found stub,
+// like when IgnoreNotFoundDependencies is true, so CheckDependencies reports it.
+// Not found stubs that were only imported by the removed file are also removed.
+func (d *Dep) RemoveFile(filepath string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	df, ok := d.Files[filepath]
+	if !ok {
+		return fmt.Errorf("File %s not found", filepath)
+	}
+
+	d.removeFile(df)
+	return nil
+}
+
+// Reloads a file from the location it was read from, replacing the current one.
+// The file must have been added using AddFile, AddFileFS or the AddPath functions,
+// or loaded from an include directory.
+func (d *Dep) ReloadFile(filepath string) error {
+	d.mu.RLock()
+	df, ok := d.Files[filepath]
+	d.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("File %s not found", filepath)
+	}
+	if df.source == nil {
+		return fmt.Errorf("File %s was not read from a filesystem and can't be reloaded, use ReloadReader", filepath)
+	}
+
+	pfile, err := d.parseFileFS(filepath, df.source.fsys, df.source.filename)
+	if err != nil {
+		return err
+	}
+
+	return d.reloadProtoFile(filepath, pfile, df.source)
+}
+
+// Reloads a file using a reader, replacing the current one and keeping its DepFileType.
+func (d *Dep) ReloadReader(filepath string, r io.Reader) error {
+	pfile, err := d.parse(filepath, r)
+	if err != nil {
+		return err
+	}
+
+	return d.reloadProtoFile(filepath, pfile, nil)
+}
+
+func (d *Dep) reloadProtoFile(filepath string, pfile *fproto.ProtoFile, source *fileSource) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	df, ok := d.Files[filepath]
+	if !ok {
+		return fmt.Errorf("File %s not found", filepath)
+	}
+	if source == nil {
+		source = df.source
+	}
+
+	return d.addProtoFile(filepath, pfile, df.DepType, source)
+}
+
+// Removes a file and its indexes.
+func (d *Dep) removeFile(df *DepFile) {
+	d.removeFileIndexes(df)
+
+	if len(d.importedBy[df.FilePath]) > 0 {
+		// still imported, keep as a not found stub
+		d.setFile(df.FilePath, &DepFile{
+			FilePath:  df.FilePath,
+			DepType:   DepType_Imported,
+			Dep:       d,
+			ProtoFile: nil,
+			NotFound:  true,
+		})
+	} else {
+		d.setFile(df.FilePath, nil)
+	}
+
+	if df.ProtoFile != nil {
+		d.removeUnusedStubs(df.ProtoFile.Dependencies)
+	}
+}
+
+// Removes the not found stubs of the list that are not imported by any file.
+func (d *Dep) removeUnusedStubs(filepaths []string) {
+	for _, fp := range filepaths {
+		if df, ok := d.Files[fp]; ok && df.NotFound && len(d.importedBy[fp]) == 0 {
+			d.setFile(fp, nil)
+		}
+	}
+}
+
+// Removes the file from the Packages and Extensions lists, and from the reverse dependency index.
+func (d *Dep) removeFileIndexes(df *DepFile) {
+	if df.ProtoFile == nil {
+		return
+	}
+
+	// package list
+	pkg := df.ProtoFile.PackageName
+	d.Packages[pkg] = removeString(d.Packages[pkg], df.FilePath)
+	if len(d.Packages[pkg]) == 0 {
+		delete(d.Packages, pkg)
+	}
+
+	// symbol index
+	d.removeSymbols(df)
+
+	// extension list, each extend block added the package once
+	for _, m := range extendElements(df.ProtoFile) {
+		d.Extensions[m.Name] = removeString(d.Extensions[m.Name], pkg)
+		if len(d.Extensions[m.Name]) == 0 {
+			delete(d.Extensions, m.Name)
+		}
+	}
+
+	// reverse dependency index
+	for _, fd := range df.ProtoFile.Dependencies {
+		delete(d.importedBy[fd], df.FilePath)
+		if len(d.importedBy[fd]) == 0 {
+			delete(d.importedBy, fd)
+		}
+	}
+}
+
+// Removes the first occurrence of the value from the list.
+func removeString(list []string, value string) []string {
+	for i, item := range list {
+		if item == value {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
@@ -0,0 +1,72 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepRemoveReload(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Own},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"myapp/proto/p_user/user.proto", testfile_user, DepType_Own},
+	})
+
+	// reloading must not duplicate the indexes
+	for i := 0; i < 2; i++ {
+		if err := dep.ReloadReader("p_option/option.proto", strings.NewReader(testfile_option)); err != nil {
+			t.Fatalf("Error reloading option.proto: %v", err)
+		}
+	}
+
+	if p := dep.Packages["p_option"]; len(p) != 1 {
+		t.Fatalf("Package p_option should have 1 file, but has %d", len(p))
+	}
+
+	if e := dep.Extensions["google.protobuf.FieldOptions"]; len(e) != 1 {
+		t.Fatalf("google.protobuf.FieldOptions should have 1 extension, but has %d", len(e))
+	}
+
+	if i := dep.GetImporters(dep.Files["google/protobuf/descriptor.proto"]); len(i) != 1 {
+		t.Fatalf("descriptor.proto should have 1 importer, but has %d", len(i))
+	}
+
+	// removing a file that is still imported keeps a stub
+	if err := dep.RemoveFile("google/protobuf/empty.proto"); err != nil {
+		t.Fatalf("Error removing empty.proto: %v", err)
+	}
+
+	if df, ok := dep.Files["google/protobuf/empty.proto"]; !ok || !df.NotFound {
+		t.Fatalf("empty.proto should have been kept as a not found stub")
+	}
+
+	if err := dep.CheckDependencies(); err == nil {
+		t.Fatalf("CheckDependencies should report the removed empty.proto")
+	}
+
+	if t_empty, _ := dep.FindType("google.protobuf.Empty"); t_empty != nil {
+		t.Fatalf("google.protobuf.Empty should not be found after removing its file")
+	}
+
+	// removing the importer removes the stub
+	if err := dep.RemoveFile("myapp/proto/p_user/user.proto"); err != nil {
+		t.Fatalf("Error removing user.proto: %v", err)
+	}
+
+	if _, ok := dep.Files["google/protobuf/empty.proto"]; ok {
+		t.Fatalf("empty.proto stub should have been removed with its only importer")
+	}
+
+	if _, ok := dep.Packages["p_user"]; ok {
+		t.Fatalf("Package p_user should have been removed")
+	}
+
+	if err := dep.RemoveFile("p_option/option.proto"); err != nil {
+		t.Fatalf("Error removing option.proto: %v", err)
+	}
+
+	if _, ok := dep.Extensions["google.protobuf.FieldOptions"]; ok {
+		t.Fatalf("Extensions of google.protobuf.FieldOptions should have been removed")
+	}
+}
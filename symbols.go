@@ -0,0 +1,161 @@
+package fdep
+
+import "github.com/RangelReale/fproto"
+
+// Returns the canonical types declared with the fully-qualified name, like
+// "google.protobuf.Empty" or "app.core.SendMail.Body".
+// More than one type is only returned if the same name is declared on more than one file.
+//
+// Canonical types are created once when the file is added, and must not be modified.
+// Each message, enum and service has only one, with the package as Alias, so the types
+// returned by this function, by the GetTypes functions (from any file or type), by
+// DepTypeFromElement, by DepType.Parent, by the enumeration functions and by the Walker can
+// be compared by pointer. Use DepType.IsSame to compare with the types of a reloaded file.
+func (d *Dep) LookupSymbol(name string) []*DepType {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]*DepType(nil), d.symbols[name]...)
+}
+
+// Returns the canonical type of the element of the file, or a new one if the
+// element is not on the symbol index.
+func (d *Dep) elementType(df *DepFile, element fproto.FProtoElement) *DepType {
+	d.mu.RLock()
+	t, ok := d.symbolItems[element]
+	d.mu.RUnlock()
+	if ok {
+		return t
+	}
+	return NewDepTypeFromElement(df, element)
+}
+
+// Adds the messages, enums and services of the file to the symbol index, and the
+// extend blocks to the element index only, as they don't declare a type.
+// The canonical types are created the first time the file is added, so a file that
+// is added again after a failed replacement keeps its types.
+func (d *Dep) addSymbols(filepath string) {
+	df := d.Files[filepath]
+	if df.symbols == nil && df.extends == nil {
+		for _, element := range symbolElements(df.ProtoFile) {
+			df.symbols = append(df.symbols, NewDepTypeFromElement(df, element))
+		}
+		for _, m := range extendElements(df.ProtoFile) {
+			df.extends = append(df.extends, NewDepTypeFromElement(df, m))
+		}
+	}
+
+	if d.symbols == nil {
+		// allocated here so a Dep created without NewDep also works
+		d.symbols = make(map[string][]*DepType)
+		d.symbolItems = make(map[fproto.FProtoElement]*DepType)
+	}
+
+	for _, t := range df.symbols {
+		name := t.FullOriginalName()
+		d.symbols[name] = append(d.symbols[name], t)
+		d.symbolItems[t.Item] = t
+	}
+	for _, t := range df.extends {
+		d.symbolItems[t.Item] = t
+	}
+}
+
+// Removes the types of the file from the symbol index.
+func (d *Dep) removeSymbols(df *DepFile) {
+	for _, m := range extendElements(df.ProtoFile) {
+		delete(d.symbolItems, m)
+	}
+
+	for _, element := range symbolElements(df.ProtoFile) {
+		t, ok := d.symbolItems[element]
+		if !ok {
+			continue
+		}
+		delete(d.symbolItems, element)
+
+		name := t.FullOriginalName()
+		var list []*DepType
+		for _, st := range d.symbols[name] {
+			if st != t {
+				list = append(list, st)
+			}
+		}
+		if len(list) == 0 {
+			delete(d.symbols, name)
+		} else {
+			d.symbols[name] = list
+		}
+	}
+}
+
+// Returns the messages (including nested), enums and services of the file.
+func symbolElements(pfile *fproto.ProtoFile) []fproto.FProtoElement {
+	var ret []fproto.FProtoElement
+
+	var addMessages func(messages []*fproto.MessageElement)
+	addMessages = func(messages []*fproto.MessageElement) {
+		for _, m := range messages {
+			if m.IsExtend {
+				continue
+			}
+			ret = append(ret, m)
+			for _, e := range m.Enums {
+				ret = append(ret, e)
+			}
+			addMessages(m.Messages)
+		}
+	}
+	addMessages(pfile.Messages)
+
+	for _, e := range pfile.Enums {
+		ret = append(ret, e)
+	}
+	for _, s := range pfile.Services {
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// Returns the extend blocks of the file, including the ones nested in messages.
+func extendElements(pfile *fproto.ProtoFile) []*fproto.MessageElement {
+	var ret []*fproto.MessageElement
+	for _, em := range pfile.CollectExtendMessages() {
+		if m, ok := em.(*fproto.MessageElement); ok && m.IsExtend {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// Returns whether the list contains the type pointer.
+func containsDepType(list []*DepType, t *DepType) bool {
+	for _, lt := range list {
+		if lt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the symbols with the name that are visible from the file, or all of them if
+// the file is nil. The second return value is false if the name is not on the index.
+func (d *Dep) findSymbols(name string, depfile *DepFile) ([]*DepType, bool) {
+	syms, ok := d.symbols[name]
+	if !ok {
+		return nil, false
+	}
+	if depfile == nil {
+		return syms, true
+	}
+
+	// more than one symbol is only found if the name is declared on more than one file
+	var ret []*DepType
+	deps := depfile.dependencySet()
+	for _, t := range syms {
+		if deps[t.DepFile.FilePath] {
+			ret = append(ret, t)
+		}
+	}
+	return ret, true
+}
@@ -0,0 +1,172 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepSymbols(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+	})
+
+	t1, err := dep.GetType("p_user.User.Address")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	t2, err := dep.GetType("p_user.User.Address")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if t1 != t2 {
+		t.Fatalf("The same type should return the same canonical *DepType")
+	}
+	if syms := dep.LookupSymbol("p_user.User.Address"); len(syms) != 1 || syms[0] != t1 {
+		t.Fatalf("LookupSymbol should return the canonical type")
+	}
+	if dep.DepTypeFromElement(t1.Item) != t1 {
+		t.Fatalf("DepTypeFromElement should return the canonical type")
+	}
+
+	// relative lookups return the same element
+	user, err := dep.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	address, err := user.GetType("Address")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if !address.IsSame(t1) || address.IsSame(user) {
+		t.Fatalf("IsSame should compare the elements")
+	}
+	if t1.Parent() != user {
+		t.Fatalf("Parent should return the canonical type")
+	}
+
+	// lookups from the file itself return the canonical type, with the package as alias
+	if address != t1 || address.Alias != "p_user" || address.OriginalAlias != "p_user" {
+		t.Fatalf("Local lookups should return the canonical type")
+	}
+
+	// lookups from other files return the canonical type
+	empty, err := dep.GetType("google.protobuf.Empty")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	empty2, err := user.GetType("google.protobuf.Empty")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if empty2 != empty {
+		t.Fatalf("Lookups from other files should return the canonical type")
+	}
+
+	// removal updates the index
+	if err = dep.RemoveFile("p_user/user.proto"); err != nil {
+		t.Fatalf("Error removing file: %v", err)
+	}
+	if syms := dep.LookupSymbol("p_user.User.Address"); len(syms) != 0 {
+		t.Fatalf("Removed types should not be on the symbol index")
+	}
+	if tp, err := dep.FindType("p_user.User"); err != nil || tp != nil {
+		t.Fatalf("Removed type should not be found")
+	}
+}
+
+func TestDepTypeIsSame(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+	})
+
+	// scalars have no file, so they are never the same type
+	i1, err := dep.GetType("int32")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	i2, err := dep.GetType("int32")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	str, err := dep.GetType("string")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	user, err := dep.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if i1.IsSame(i2) || i1.IsSame(str) || i1.IsSame(user) || user.IsSame(i1) {
+		t.Fatalf("Scalar types should not be the same")
+	}
+
+	// the types of a reloaded file are the same as the previous ones
+	if err := dep.ReloadReader("p_user/user.proto", strings.NewReader(testfile_user)); err != nil {
+		t.Fatalf("Error reloading file: %v", err)
+	}
+	reloaded, err := dep.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if reloaded == user || !reloaded.IsSame(user) || !user.IsSame(reloaded) {
+		t.Fatalf("The type of the reloaded file should be the same")
+	}
+	if address, err := reloaded.GetType("Address"); err != nil || address.IsSame(reloaded) {
+		t.Fatalf("Different types should not be the same")
+	}
+}
+
+func TestDepSymbolsSameFile(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+	})
+
+	global, err := dep.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	address, err := dep.GetType("p_user.User.Address")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+
+	// the same file returns the canonical type
+	local, err := dep.GetFile("p_user/user.proto").GetType("User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	localAddress, err := dep.GetFile("p_user/user.proto").GetType("User.Address")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if local != global || localAddress != address || local.Alias != "p_user" {
+		t.Fatalf("Lookups from the same file should return the canonical type")
+	}
+	if syms := dep.LookupSymbol("p_user.User"); len(syms) != 1 || syms[0] != local {
+		t.Fatalf("LookupSymbol should return the canonical type")
+	}
+	if address.Parent() != local || localAddress.Parent() != global {
+		t.Fatalf("Parent should return the canonical type")
+	}
+
+	// other files return the canonical type
+	other, err := dep.GetFile("p_descriptor/descriptor.proto").GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	group, err := dep.GetType("p_descriptor.Group")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	other2, err := group.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	if other != global || other2 != global {
+		t.Fatalf("Lookups from other files should return the canonical type")
+	}
+}
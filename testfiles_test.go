@@ -1,5 +1,36 @@
 package fdep
 
+import (
+	"strings"
+	"testing"
+)
+
+// A file added to the tests' Dep.
+type testFile struct {
+	filepath, content string
+	deptype           DepFileType
+}
+
+// Creates a new Dep with the files, failing the test on any error.
+func newTestDep(t *testing.T, files []testFile) *Dep {
+	t.Helper()
+
+	dep := NewDep()
+	addTestFiles(t, dep, files)
+	return dep
+}
+
+// Adds the files to the Dep in order using AddReader, failing the test on any error.
+func addTestFiles(t *testing.T, dep *Dep, files []testFile) {
+	t.Helper()
+
+	for _, f := range files {
+		if err := dep.AddReader(f.filepath, strings.NewReader(f.content), f.deptype); err != nil {
+			t.Fatalf("Error parsing %s: %v", f.filepath, err)
+		}
+	}
+}
+
 var (
 	testfile_user = `
 syntax = "proto3";
@@ -54,5 +85,187 @@ option cc_enable_arenas = true;
 //
 // The JSON representation for "Empty"" is empty JSON object ""{}"".
 message Empty {}
+`
+
+	testfile_public_a = `
+syntax = "proto3";
+package p_a;
+
+import "p_b/b.proto";
+
+message A {
+	p_d.D d = 1;
+}
+`
+
+	testfile_public_b = `
+syntax = "proto3";
+package p_b;
+
+import public "p_c/c.proto";
+`
+
+	testfile_public_c = `
+syntax = "proto3";
+package p_c;
+
+import public "p_d/d.proto";
+`
+
+	testfile_public_d = `
+syntax = "proto3";
+package p_d;
+
+message D {
+	string name = 1;
+}
+`
+
+	testfile_cycle_a = `
+syntax = "proto3";
+package p_cycle;
+
+import "p_cycle/b.proto";
+`
+
+	testfile_cycle_b = `
+syntax = "proto3";
+package p_cycle;
+
+import "p_cycle/a.proto";
+`
+
+	testfile_link = `
+syntax = "proto3";
+package p_link;
+
+message Order {
+	string id = 1;
+	Customer customer = 2;
+	map<string, Item> items = 3;
+}
+
+message Item {
+	string name = 1;
+}
+
+service OrderSvc {
+	rpc Get(Order) returns (OrderResponse);
+}
+`
+
+	testfile_invalid = `
+syntax = "proto3";
+package p_invalid;
+
+message Invalid {
+	string name = 1
+`
+
+	testfile_google_descriptor = `
+syntax = "proto2";
+
+package google.protobuf;
+
+message FieldOptions {
+	optional bool deprecated = 3 [default=false];
+
+	extensions 1000 to max;
+}
+`
+
+	testfile_option = `
+syntax = "proto3";
+package p_option;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.FieldOptions {
+	string jsontag = 50000;
+}
+
+message Tagged {
+	string name = 1 [(p_option.jsontag) = "tagged_name"];
+}
+`
+
+	testfile_descriptor = `
+syntax = "proto3";
+package p_descriptor;
+
+import "p_user/user.proto";
+
+message Group {
+	string group_name = 1;
+	map<string, p_user.User> user_map = 2;
+
+	oneof owner {
+		p_user.User user = 3;
+		string team = 4;
+	}
+}
+	`
+
+	testfile_nested_extend = `
+syntax = "proto2";
+package p_nested;
+
+import "google/protobuf/descriptor.proto";
+
+message Outer {
+	message Inner {
+		optional string value = 1;
+	}
+
+	extend google.protobuf.FieldOptions {
+		optional Inner inner_option = 50001;
+	}
+
+	optional Inner inner = 1;
+}
+`
+
+	testfile_defaults = `
+syntax = "proto2";
+package p_defaults;
+
+enum Level {
+	LOW = 0;
+	HIGH = 1;
+}
+
+message Settings {
+	optional string title = 1 [default = "hello world"];
+	optional Level level = 2 [default = HIGH];
+	optional int32 count = 3 [default = 10, json_name = "total"];
+}
+`
+
+	testfile_escape = `
+syntax = "proto2";
+package p_escape;
+
+import "p_option/option.proto";
+
+message Escaped {
+	optional string name = 1 [default = "h\303\251llo \"w\303\266rld\"\n\001", (p_option.jsontag) = "t\303\241g\t\177"];
+	optional bytes data = 2 [default = "\303\251\000'\377"];
+}
+`
+
+	testfile_optional = `
+syntax = "proto3";
+package p_optional;
+
+message Item {
+	optional string name = 1;
+	oneof kind {
+		string a = 2;
+		int32 b = 3;
+	}
+	optional int32 count = 4;
+	int32 _size = 5;
+	optional int32 size = 6;
+}
 `
 )
@@ -0,0 +1,267 @@
+package fdep
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/RangelReale/fproto"
+)
+
+// A graph of how messages, enums and services reference each other.
+type TypeGraph struct {
+	// The types of the graph, sorted by full name.
+	Nodes []*DepType
+
+	// The references between the types, in declaration order.
+	Edges []*TypeGraphEdge
+}
+
+// A reference between two types of a type graph.
+type TypeGraphEdge struct {
+	// The referencing message or service. For extensions, the extended type.
+	From *DepType
+
+	// The referenced type.
+	To *DepType
+
+	// The kind of the reference.
+	Kind TypeReferenceKind
+
+	// Whether the reference is a field of an extend block.
+	Extension bool
+
+	// The edge label, like the field name and its cardinality, or the RPC name.
+	Label string
+}
+
+// Returns the graph of the type references of all files. The nodes are all messages and
+// enums, and the services that reference them, as the canonical types of the symbol index.
+// Scalar types are not part of the graph, and names that are not found or are
+// ambiguous are ignored.
+// If roots are passed, only the types reachable from them are returned.
+func (d *Dep) TypeGraph(roots ...string) (*TypeGraph, error) {
+	var edges []*TypeGraphEdge
+
+	for _, df := range d.GetFiles() {
+		// the resolved extended types, by extend block
+		extended := make(map[fproto.FProtoElement]*DepType)
+
+		for _, ref := range df.typeNameReferences() {
+			t, err := ref.resolve()
+			if err != nil {
+				return nil, err
+			}
+			if len(t) != 1 {
+				continue
+			}
+
+			if t[0].IsScalar() {
+				continue
+			}
+
+			// the resolved type name can be relative to the scope
+			to := d.elementType(t[0].DepFile, t[0].Item)
+
+			if ref.kind == TypeReference_Extend {
+				extended[ref.element] = to
+				continue
+			}
+
+			edge := &TypeGraphEdge{
+				From:  ref.owner,
+				To:    to,
+				Kind:  ref.kind,
+				Label: typeGraphLabel(ref),
+			}
+			if et, ok := extended[ref.owner.Item]; ok {
+				edge.From = et
+				edge.Extension = true
+			} else if m, ok := ref.owner.Item.(*fproto.MessageElement); ok && m.IsExtend {
+				// extended type not found
+				continue
+			}
+			edges = append(edges, edge)
+		}
+	}
+
+	ret := &TypeGraph{}
+	nodes := make(map[interface{}]*DepType)
+
+	if len(roots) == 0 {
+		ret.Edges = edges
+		for _, t := range d.AllTypes(TypeFilter{Kinds: TypeKind_Message | TypeKind_Enum}) {
+			nodes[typeReferenceKey(t)] = t
+		}
+		for _, e := range edges {
+			nodes[typeReferenceKey(e.From)] = e.From
+			nodes[typeReferenceKey(e.To)] = e.To
+		}
+	} else {
+		// closure of the roots
+		var queue []*DepType
+		for _, r := range roots {
+			t, err := d.GetType(r)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, fmt.Errorf("Type '%s' not found", r)
+			}
+			if t.IsScalar() {
+				return nil, fmt.Errorf("Type '%s' is a scalar", r)
+			}
+			if _, ok := nodes[typeReferenceKey(t)]; !ok {
+				nodes[typeReferenceKey(t)] = t
+				queue = append(queue, t)
+			}
+		}
+
+		// the edges from each type
+		adjacency := make(map[interface{}][]*TypeGraphEdge)
+		for _, e := range edges {
+			key := typeReferenceKey(e.From)
+			adjacency[key] = append(adjacency[key], e)
+		}
+
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, e := range adjacency[typeReferenceKey(cur)] {
+				if _, ok := nodes[typeReferenceKey(e.To)]; !ok {
+					nodes[typeReferenceKey(e.To)] = e.To
+					queue = append(queue, e.To)
+				}
+			}
+		}
+
+		for _, e := range edges {
+			_, from_ok := nodes[typeReferenceKey(e.From)]
+			_, to_ok := nodes[typeReferenceKey(e.To)]
+			if from_ok && to_ok {
+				ret.Edges = append(ret.Edges, e)
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		ret.Nodes = append(ret.Nodes, n)
+	}
+	sort.Slice(ret.Nodes, func(i, j int) bool {
+		return ret.Nodes[i].FullOriginalName() < ret.Nodes[j].FullOriginalName()
+	})
+
+	return ret, nil
+}
+
+// Returns the label of the edge of a reference.
+func typeGraphLabel(ref *typeNameReference) string {
+	switch xel := ref.element.(type) {
+	case *fproto.FieldElement:
+		name := xel.Name
+		if m, ok := ref.owner.Item.(*fproto.MessageElement); ok && m.IsExtend && ref.depfile.ProtoFile.PackageName != "" {
+			name = fmt.Sprintf("(%s.%s)", ref.depfile.ProtoFile.PackageName, xel.Name)
+		}
+		switch {
+		case ref.kind == TypeReference_OneOfField:
+			return name + " oneof"
+		case fieldElementLabel(xel) == FieldLabel_Repeated:
+			return name + " []"
+		}
+		return name
+	case *fproto.MapFieldElement:
+		return fmt.Sprintf("%s map<%s>", xel.Name, xel.KeyType)
+	case *fproto.RPCElement:
+		if ref.kind == TypeReference_RPCRequest {
+			if xel.StreamsRequest {
+				return xel.Name + " stream request"
+			}
+			return xel.Name + " request"
+		}
+		if xel.StreamsResponse {
+			return xel.Name + " stream response"
+		}
+		return xel.Name + " response"
+	}
+	return ""
+}
+
+// Writes the graph in the Graphviz DOT format.
+// Messages are drawn as boxes, enums as octagons and services as components.
+// Extension edges are dashed.
+func (g *TypeGraph) WriteDot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph types {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [fontname=\"Helvetica\"];")
+
+	for _, n := range g.Nodes {
+		shape := "box"
+		switch n.Item.(type) {
+		case *fproto.EnumElement:
+			shape = "octagon"
+		case *fproto.ServiceElement:
+			shape = "component"
+		}
+		fmt.Fprintf(bw, "\t%s [shape=%s];\n", dotQuote(n.FullOriginalName()), shape)
+	}
+
+	for _, e := range g.Edges {
+		attrs := []string{"label=" + dotQuote(e.Label)}
+		if e.Extension {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(bw, "\t%s -> %s [%s];\n", dotQuote(e.From.FullOriginalName()), dotQuote(e.To.FullOriginalName()),
+			strings.Join(attrs, ", "))
+	}
+
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// Writes the graph as a Mermaid flowchart.
+// Messages are drawn as rectangles, enums as hexagons and services as subroutines.
+// Extension edges are dotted.
+func (g *TypeGraph) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "flowchart LR")
+
+	ids := make(map[interface{}]string)
+	for ni, n := range g.Nodes {
+		id := fmt.Sprintf("t%d", ni)
+		ids[typeReferenceKey(n)] = id
+
+		label := mermaidQuote(n.FullOriginalName())
+		switch n.Item.(type) {
+		case *fproto.EnumElement:
+			fmt.Fprintf(bw, "\t%s{{%s}}\n", id, label)
+		case *fproto.ServiceElement:
+			fmt.Fprintf(bw, "\t%s[[%s]]\n", id, label)
+		default:
+			fmt.Fprintf(bw, "\t%s[%s]\n", id, label)
+		}
+	}
+
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Extension {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(bw, "\t%s %s|%s| %s\n", ids[typeReferenceKey(e.From)], arrow, mermaidQuote(e.Label), ids[typeReferenceKey(e.To)])
+	}
+
+	return bw.Flush()
+}
+
+// Returns a quoted Mermaid label.
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, "\"", "#quot;")
+	s = strings.ReplaceAll(s, "<", "#lt;")
+	s = strings.ReplaceAll(s, ">", "#gt;")
+	return "\"" + s + "\""
+}
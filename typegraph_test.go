@@ -0,0 +1,84 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDepTypeGraph(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Own},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+		{"p_d/d.proto", testfile_public_d, DepType_Own},
+	})
+
+	g, err := dep.TypeGraph("p_descriptor.Group")
+	if err != nil {
+		t.Fatalf("Error building type graph: %v", err)
+	}
+
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.FullOriginalName())
+	}
+	if n := strings.Join(nodes, ","); n != "p_descriptor.Group,p_user.User,p_user.User.Address" {
+		t.Fatalf("Unexpected type graph nodes: %s", n)
+	}
+	if len(g.Edges) != 3 {
+		t.Fatalf("Type graph should have 3 edges, but has %d", len(g.Edges))
+	}
+
+	var out strings.Builder
+	if err = g.WriteDot(&out); err != nil {
+		t.Fatalf("Error writing type graph: %v", err)
+	}
+	for _, s := range []string{
+		`"p_descriptor.Group" -> "p_user.User" [label="user_map map<string>"];`,
+		`"p_descriptor.Group" -> "p_user.User" [label="user oneof"];`,
+		`"p_user.User" -> "p_user.User.Address" [label="address"];`,
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("Type graph should contain %s:\n%s", s, out.String())
+		}
+	}
+
+	out.Reset()
+	if err = g.WriteMermaid(&out); err != nil {
+		t.Fatalf("Error writing type graph: %v", err)
+	}
+	if !strings.Contains(out.String(), `t1 -->|"address"| t2`) {
+		t.Fatalf("Unexpected mermaid type graph:\n%s", out.String())
+	}
+
+	// the whole graph includes the service and the types without references
+	g, err = dep.TypeGraph()
+	if err != nil {
+		t.Fatalf("Error building type graph: %v", err)
+	}
+	if len(g.Nodes) != 7 {
+		t.Fatalf("Type graph should have 7 nodes, but has %d", len(g.Nodes))
+	}
+
+	// the nodes are the canonical types
+	d, err := dep.GetType("p_d.D")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	found := false
+	for _, n := range g.Nodes {
+		found = found || n == d
+	}
+	if !found {
+		t.Fatalf("Type graph nodes should contain the canonical p_d.D")
+	}
+	user, err := dep.GetType("p_user.User")
+	if err != nil {
+		t.Fatalf("Error getting type: %v", err)
+	}
+	for _, e := range g.Edges {
+		if e.To.FullOriginalName() == "p_user.User" && e.To != user {
+			t.Fatalf("Type graph edges should point to the canonical types")
+		}
+	}
+}
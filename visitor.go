@@ -0,0 +1,370 @@
+package fdep
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/RangelReale/fproto"
+)
+
+// Returned by a Visitor method to skip the children of the visited element.
+// It is ignored when returned by methods of elements without children.
+var SkipChildren = errors.New("skip children")
+
+// Visitor receives the elements of the files walked by Dep.Walk or DepFile.Walk.
+//
+// The referenced types are already resolved in the scope of the element, the same
+// way as DepType.GetTypes. Messages, enums, services and extend blocks are the
+// canonical types.
+//
+// If a method returns SkipChildren (or an error wrapping it), the children of the
+// element are not visited. Any other error stops the walk and is returned.
+//
+// Embed BaseVisitor to implement only some of the methods.
+type Visitor interface {
+	// Visits a file. The children are the messages, enums, services and extend blocks
+	// declared on the file root.
+	VisitFile(df *DepFile) error
+
+	// Visits a message. The children are the fields, nested enums, nested messages and
+	// nested extend blocks.
+	VisitMessage(message *DepType) error
+
+	// Visits a field of a message, oneof or extend block, with its resolved type.
+	// The owner is the message or extend block.
+	VisitField(owner *DepType, fld *fproto.FieldElement, fieldType *DepType) error
+
+	// Visits a map field of a message, with its resolved key and value types.
+	VisitMapField(owner *DepType, fld *fproto.MapFieldElement, keyType *DepType, valueType *DepType) error
+
+	// Visits a oneof of a message. The children are the oneof fields.
+	VisitOneOf(owner *DepType, oneof *fproto.OneOfFieldElement) error
+
+	// Visits an enum. The children are the enum values.
+	VisitEnum(enum *DepType) error
+
+	// Visits a value of an enum.
+	VisitEnumValue(enum *DepType, value *fproto.EnumConstantElement) error
+
+	// Visits a service. The children are the methods.
+	VisitService(service *DepType) error
+
+	// Visits a method of a service, with its resolved request and response types.
+	VisitMethod(service *DepType, rpc *fproto.RPCElement, requestType *DepType, responseType *DepType) error
+
+	// Visits an extend block, with the resolved extended type. The children are the fields.
+	VisitExtend(extend *DepType, extendedType *DepType) error
+}
+
+// A Visitor that does nothing, to be embedded on visitors that implement only some methods.
+type BaseVisitor struct{}
+
+func (BaseVisitor) VisitFile(df *DepFile) error { return nil }
+
+func (BaseVisitor) VisitMessage(message *DepType) error { return nil }
+
+func (BaseVisitor) VisitField(owner *DepType, fld *fproto.FieldElement, fieldType *DepType) error {
+	return nil
+}
+
+func (BaseVisitor) VisitMapField(owner *DepType, fld *fproto.MapFieldElement, keyType *DepType, valueType *DepType) error {
+	return nil
+}
+
+func (BaseVisitor) VisitOneOf(owner *DepType, oneof *fproto.OneOfFieldElement) error { return nil }
+
+func (BaseVisitor) VisitEnum(enum *DepType) error { return nil }
+
+func (BaseVisitor) VisitEnumValue(enum *DepType, value *fproto.EnumConstantElement) error {
+	return nil
+}
+
+func (BaseVisitor) VisitService(service *DepType) error { return nil }
+
+func (BaseVisitor) VisitMethod(service *DepType, rpc *fproto.RPCElement, requestType *DepType, responseType *DepType) error {
+	return nil
+}
+
+func (BaseVisitor) VisitExtend(extend *DepType, extendedType *DepType) error { return nil }
+
+// Walks all files sorted by path, calling the visitor for each element.
+// If file types are passed, only files of these types are walked.
+// Files that were not found are skipped.
+// An error is returned if any referenced type is not found or is ambiguous.
+func (d *Dep) Walk(v Visitor, fileTypes ...DepFileType) error {
+	filter := TypeFilter{FileTypes: fileTypes}
+	for _, df := range d.GetFiles() {
+		if !filter.matchFile(df) {
+			continue
+		}
+		if err := df.Walk(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walks the file, calling the visitor for each element.
+// The elements of the file root and of each message are visited by kind: messages, enums,
+// services and extend blocks, each in declaration order. Nested elements are visited
+// after their parent.
+// An error is returned if any referenced type is not found or is ambiguous.
+func (df *DepFile) Walk(v Visitor) error {
+	return df.walk(v, true)
+}
+
+// Walks the file. If resolve is false, the types are not resolved and are passed as nil
+// to the visitor, for the passes that handle the names that are not found themselves.
+func (df *DepFile) walk(v Visitor, resolve bool) error {
+	if df.ProtoFile == nil {
+		return nil
+	}
+
+	w := &walker{depfile: df, v: v, resolve: resolve, extends: make(map[fproto.FProtoElement][]*fproto.MessageElement)}
+	for _, m := range extendElements(df.ProtoFile) {
+		parent := m.ParentElement()
+		if parent == nil {
+			parent = df.ProtoFile
+		}
+		w.extends[parent] = append(w.extends[parent], m)
+	}
+	return w.walkFile()
+}
+
+// Walks the elements of a file.
+type walker struct {
+	depfile *DepFile
+	v       Visitor
+	resolve bool
+
+	// extend blocks by the element where they are declared
+	extends map[fproto.FProtoElement][]*fproto.MessageElement
+}
+
+// Resolves a type name in the scope, or in the file scope if nil. Returns nil if the
+// walker doesn't resolve types.
+func (w *walker) resolveTypeName(scope *DepType, name string) (*DepType, error) {
+	if !w.resolve {
+		return nil, nil
+	}
+	return w.depfile.resolveTypeName(scope, name)
+}
+
+// Returns the type in which scope the names of an extend block are resolved: the
+// message where it is declared, or nil for the file scope.
+func extendScope(df *DepFile, m *fproto.MessageElement) *DepType {
+	if _, isfile := m.ParentElement().(*fproto.ProtoFile); !isfile && m.ParentElement() != nil {
+		return df.Dep.elementType(df, m.ParentElement())
+	}
+	return nil
+}
+
+// Returns the type in which scope the names of the fields of a message or extend
+// block are resolved.
+func fieldScope(owner *DepType) *DepType {
+	if m, ok := owner.Item.(*fproto.MessageElement); ok && m.IsExtend {
+		return extendScope(owner.DepFile, m)
+	}
+	return owner
+}
+
+// Calls a visit method, returning whether the children must be visited.
+func visitChildren(err error) (bool, error) {
+	if errors.Is(err, SkipChildren) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Calls a visit method of an element without children.
+func visitLeaf(err error) error {
+	if errors.Is(err, SkipChildren) {
+		return nil
+	}
+	return err
+}
+
+func (w *walker) walkFile() error {
+	pfile := w.depfile.ProtoFile
+
+	if ok, err := visitChildren(w.v.VisitFile(w.depfile)); !ok {
+		return err
+	}
+
+	if err := w.walkMessages(pfile.Messages); err != nil {
+		return err
+	}
+	if err := w.walkEnums(pfile.Enums); err != nil {
+		return err
+	}
+
+	for _, s := range pfile.Services {
+		if err := w.walkService(s); err != nil {
+			return err
+		}
+	}
+
+	return w.walkExtends(pfile)
+}
+
+func (w *walker) walkMessages(messages []*fproto.MessageElement) error {
+	for _, m := range messages {
+		if m.IsExtend {
+			continue
+		}
+
+		mt := w.depfile.Dep.elementType(w.depfile, m)
+		ok, err := visitChildren(w.v.VisitMessage(mt))
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		if err := w.walkFields(mt, mt, m.Fields); err != nil {
+			return err
+		}
+		if err := w.walkEnums(m.Enums); err != nil {
+			return err
+		}
+		if err := w.walkMessages(m.Messages); err != nil {
+			return err
+		}
+		if err := w.walkExtends(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walks the fields of a message or extend block, resolving their types in the scope,
+// or in the file scope if nil.
+func (w *walker) walkFields(owner *DepType, scope *DepType, fields []fproto.FieldElementTag) error {
+	for _, fld := range fields {
+		switch xfld := fld.(type) {
+		case *fproto.FieldElement:
+			t, err := w.resolveTypeName(scope, xfld.Type)
+			if err != nil {
+				return err
+			}
+			if err := visitLeaf(w.v.VisitField(owner, xfld, t)); err != nil {
+				return err
+			}
+		case *fproto.MapFieldElement:
+			kt, err := w.resolveTypeName(scope, xfld.KeyType)
+			if err != nil {
+				return err
+			}
+			vt, err := w.resolveTypeName(scope, xfld.Type)
+			if err != nil {
+				return err
+			}
+			if err := visitLeaf(w.v.VisitMapField(owner, xfld, kt, vt)); err != nil {
+				return err
+			}
+		case *fproto.OneOfFieldElement:
+			ok, err := visitChildren(w.v.VisitOneOf(owner, xfld))
+			if err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			if err := w.walkFields(owner, scope, xfld.Fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *walker) walkEnums(enums []*fproto.EnumElement) error {
+	for _, e := range enums {
+		et := w.depfile.Dep.elementType(w.depfile, e)
+		ok, err := visitChildren(w.v.VisitEnum(et))
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		for _, ec := range e.EnumConstants {
+			if err := visitLeaf(w.v.VisitEnumValue(et, ec)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *walker) walkService(s *fproto.ServiceElement) error {
+	df := w.depfile
+
+	st := df.Dep.elementType(df, s)
+	if ok, err := visitChildren(w.v.VisitService(st)); !ok {
+		return err
+	}
+
+	for _, rpc := range s.RPCs {
+		req, err := w.resolveTypeName(nil, rpc.RequestType)
+		if err != nil {
+			return err
+		}
+		resp, err := w.resolveTypeName(nil, rpc.ResponseType)
+		if err != nil {
+			return err
+		}
+		if err := visitLeaf(w.v.VisitMethod(st, rpc, req, resp)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walks the extend blocks declared on the file root or on a message.
+func (w *walker) walkExtends(parent fproto.FProtoElement) error {
+	for _, m := range w.extends[parent] {
+		if err := w.walkExtend(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) walkExtend(m *fproto.MessageElement) error {
+	df := w.depfile
+
+	scope := extendScope(df, m)
+	extended, err := w.resolveTypeName(scope, m.Name)
+	if err != nil {
+		return err
+	}
+
+	et := df.Dep.elementType(df, m)
+	if ok, err := visitChildren(w.v.VisitExtend(et, extended)); !ok {
+		return err
+	}
+
+	return w.walkFields(et, scope, m.Fields)
+}
+
+// Resolves a type name in the scope, or in the file scope if nil.
+// Returns an error if the type was not found or is ambiguous.
+func (df *DepFile) resolveTypeName(scope *DepType, name string) (*DepType, error) {
+	var t []*DepType
+	var err error
+	if scope != nil {
+		t, err = scope.GetTypes(name)
+	} else {
+		t, err = df.GetTypes(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(t) == 0 {
+		return nil, fmt.Errorf("Type '%s' not found in file %s", name, df.FilePath)
+	} else if len(t) > 1 {
+		return nil, fmt.Errorf("More than one type found for '%s' in file %s", name, df.FilePath)
+	}
+	return t[0], nil
+}
@@ -0,0 +1,132 @@
+package fdep
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RangelReale/fproto"
+)
+
+// Records the visited elements.
+type testVisitor struct {
+	BaseVisitor
+	visited []string
+	skip    string
+	extends []*DepType
+}
+
+func (v *testVisitor) VisitMessage(message *DepType) error {
+	v.visited = append(v.visited, "message:"+message.FullOriginalName())
+	if message.FullOriginalName() == v.skip {
+		return fmt.Errorf("skipping %s: %w", v.skip, SkipChildren)
+	}
+	return nil
+}
+
+func (v *testVisitor) VisitField(owner *DepType, fld *fproto.FieldElement, fieldType *DepType) error {
+	v.visited = append(v.visited, "field:"+fld.Name+":"+fieldType.TypeDescription())
+	return nil
+}
+
+func (v *testVisitor) VisitMapField(owner *DepType, fld *fproto.MapFieldElement, keyType *DepType, valueType *DepType) error {
+	v.visited = append(v.visited, "map:"+fld.Name+":"+keyType.TypeDescription()+":"+valueType.TypeDescription())
+	return nil
+}
+
+func (v *testVisitor) VisitOneOf(owner *DepType, oneof *fproto.OneOfFieldElement) error {
+	v.visited = append(v.visited, "oneof:"+oneof.Name)
+	return nil
+}
+
+func (v *testVisitor) VisitMethod(service *DepType, rpc *fproto.RPCElement, requestType *DepType, responseType *DepType) error {
+	v.visited = append(v.visited, "method:"+rpc.Name+":"+requestType.FullOriginalName()+":"+responseType.FullOriginalName())
+	return nil
+}
+
+func (v *testVisitor) VisitExtend(extend *DepType, extendedType *DepType) error {
+	v.visited = append(v.visited, "extend:"+extendedType.FullOriginalName())
+	v.extends = append(v.extends, extend)
+	return nil
+}
+
+func TestDepWalk(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/empty.proto", testfile_google_empty, DepType_Imported},
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_user/user.proto", testfile_user, DepType_Own},
+		{"p_descriptor/descriptor.proto", testfile_descriptor, DepType_Own},
+		{"p_option/option.proto", testfile_option, DepType_Own},
+	})
+
+	v := &testVisitor{skip: "p_user.User"}
+	if err := dep.Walk(v, DepType_Own); err != nil {
+		t.Fatalf("Error walking: %v", err)
+	}
+
+	expected := []string{
+		"message:p_descriptor.Group",
+		"field:group_name:string",
+		"map:user_map:string:p_user.User",
+		"oneof:owner",
+		"field:user:p_user.User",
+		"field:team:string",
+		"message:p_option.Tagged",
+		"field:name:string",
+		"extend:google.protobuf.FieldOptions",
+		"field:jsontag:string",
+		"message:p_user.User",
+		"message:p_user.UserListResponse",
+		"field:list:p_user.User",
+		"method:List:google.protobuf.Empty:p_user.UserListResponse",
+		"method:Add:p_user.User:google.protobuf.Empty",
+	}
+	if !reflect.DeepEqual(v.visited, expected) {
+		t.Fatalf("Unexpected visited elements:\n%s", strings.Join(v.visited, "\n"))
+	}
+}
+
+func TestDepWalkNestedExtend(t *testing.T) {
+	dep := newTestDep(t, []testFile{
+		{"google/protobuf/descriptor.proto", testfile_google_descriptor, DepType_Imported},
+		{"p_nested/nested.proto", testfile_nested_extend, DepType_Own},
+	})
+
+	v := &testVisitor{}
+	if err := dep.Walk(v, DepType_Own); err != nil {
+		t.Fatalf("Error walking: %v", err)
+	}
+
+	// the extend block is visited inside its message, and its fields resolved in the message scope
+	expected := []string{
+		"message:p_nested.Outer",
+		"field:inner:p_nested.Outer.Inner",
+		"message:p_nested.Outer.Inner",
+		"field:value:string",
+		"extend:google.protobuf.FieldOptions",
+		"field:inner_option:p_nested.Outer.Inner",
+	}
+	if !reflect.DeepEqual(v.visited, expected) {
+		t.Fatalf("Unexpected visited elements:\n%s", strings.Join(v.visited, "\n"))
+	}
+
+	// extend blocks are canonical types
+	v2 := &testVisitor{}
+	if err := dep.Walk(v2, DepType_Own); err != nil {
+		t.Fatalf("Error walking: %v", err)
+	}
+	if len(v.extends) != 1 || len(v2.extends) != 1 || v.extends[0] != v2.extends[0] ||
+		dep.DepTypeFromElement(v.extends[0].Item) != v.extends[0] {
+		t.Fatalf("Extend blocks should be canonical types")
+	}
+
+	// skipping the message skips the nested extend block
+	v3 := &testVisitor{skip: "p_nested.Outer"}
+	if err := dep.Walk(v3, DepType_Own); err != nil {
+		t.Fatalf("Error walking: %v", err)
+	}
+	if !reflect.DeepEqual(v3.visited, []string{"message:p_nested.Outer"}) {
+		t.Fatalf("Unexpected visited elements:\n%s", strings.Join(v3.visited, "\n"))
+	}
+}
@@ -0,0 +1,265 @@
+package fdep
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watches the files of a Dep for changes by polling the filesystem, and keeps the Dep
+// in sync with them.
+//
+// The directories added using the AddPath functions are checked for added, changed and
+// deleted .proto files. Files loaded from other locations, like the include directories,
+// are checked for changes and deletion, and not found imports are searched again in
+// the include directories.
+type Watcher struct {
+	dep *Dep
+
+	// Last known state of the files, by INTERNAL path.
+	files map[string]*watchedFile
+}
+
+// A change detected by a Watcher.
+type WatchEvent struct {
+	// The INTERNAL paths of the files added, changed and removed, sorted.
+	Added   []string
+	Changed []string
+	Removed []string
+
+	// The added, changed and removed files, plus all files that import them directly
+	// or indirectly, sorted.
+	AffectedFiles []string
+
+	// The types declared on the added and changed files, after the change.
+	Types []*DepType
+
+	// The types that were declared on the removed files.
+	RemovedTypes []*DepType
+}
+
+// The state of a watched file.
+type watchedFile struct {
+	source  fileSource
+	deptype DepFileType
+	modTime time.Time
+	size    int64
+
+	// Whether modTime and size were read.
+	stated bool
+}
+
+// Creates a new Watcher for the Dep, using the current state of the files as the starting point.
+func NewWatcher(dep *Dep) (*Watcher, error) {
+	w := &Watcher{dep: dep, files: make(map[string]*watchedFile)}
+
+	files, errs := w.scan()
+	if len(errs) > 0 {
+		return nil, newMultiError(errs)
+	}
+	w.files = files
+
+	return w, nil
+}
+
+// Checks the filesystem once, updating the Dep with the files that changed.
+// Returns nil if nothing changed.
+//
+// A file is added when it appears, and reloaded when its modification time or size changes.
+// A file that failed to load is only tried again when it changes.
+//
+// Errors reading the directories or loading the files don't stop the update, and are
+// returned together with the event. A directory that can't be read keeps the last known
+// state of its files, and a directory that was deleted reports its files as removed.
+func (w *Watcher) Poll() (*WatchEvent, error) {
+	files, errs := w.scan()
+
+	ev := &WatchEvent{}
+
+	for fp, wf := range files {
+		prev, known := w.files[fp]
+		if known && prev.modTime.Equal(wf.modTime) && prev.size == wf.size {
+			continue
+		}
+		if df := w.dep.GetFile(fp); df == nil || df.NotFound {
+			ev.Added = append(ev.Added, fp)
+		} else if known {
+			ev.Changed = append(ev.Changed, fp)
+		}
+	}
+	for fp := range w.files {
+		if _, ok := files[fp]; !ok {
+			if df := w.dep.GetFile(fp); df != nil && !df.NotFound {
+				ev.Removed = append(ev.Removed, fp)
+			}
+		}
+	}
+
+	w.files = files
+
+	if len(ev.Added) == 0 && len(ev.Changed) == 0 && len(ev.Removed) == 0 {
+		return nil, newMultiError(errs)
+	}
+
+	sort.Strings(ev.Added)
+	sort.Strings(ev.Changed)
+	sort.Strings(ev.Removed)
+
+	// apply the changes
+	for _, fp := range ev.Added {
+		wf := files[fp]
+		if err := w.dep.AddFileFS(path.Dir(fp), wf.source.fsys, wf.source.filename, wf.deptype); err != nil {
+			errs = appendError(errs, err)
+		}
+	}
+	for _, fp := range ev.Changed {
+		if err := w.dep.ReloadFile(fp); err != nil {
+			errs = appendError(errs, err)
+		}
+	}
+	for _, fp := range ev.Removed {
+		if df := w.dep.GetFile(fp); df != nil {
+			ev.RemovedTypes = append(ev.RemovedTypes, df.AllTypes(watchTypeFilter)...)
+		}
+		if err := w.dep.RemoveFile(fp); err != nil {
+			errs = appendError(errs, err)
+		}
+	}
+
+	// affected files and types
+	affected := make(map[string]bool)
+	for _, list := range [][]string{ev.Added, ev.Changed, ev.Removed} {
+		for _, fp := range list {
+			affected[fp] = true
+			if df := w.dep.GetFile(fp); df != nil {
+				for _, dependent := range w.dep.GetDependents(df) {
+					affected[dependent.DepFile.FilePath] = true
+				}
+			}
+		}
+	}
+	for fp := range affected {
+		ev.AffectedFiles = append(ev.AffectedFiles, fp)
+	}
+	sort.Strings(ev.AffectedFiles)
+
+	for _, list := range [][]string{ev.Added, ev.Changed} {
+		for _, fp := range list {
+			if df := w.dep.GetFile(fp); df != nil {
+				ev.Types = append(ev.Types, df.AllTypes(watchTypeFilter)...)
+			}
+		}
+	}
+
+	return ev, newMultiError(errs)
+}
+
+// Polls the filesystem at each interval until the context is done, calling "fn"
+// for each change or error. Returns the context error.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration, fn func(ev *WatchEvent, err error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			ev, err := w.Poll()
+			if ev != nil || err != nil {
+				fn(ev, err)
+			}
+		}
+	}
+}
+
+// Returns the current state of the files that should be loaded, and the errors reading
+// the filesystem. The files of a directory that can't be read keep their last known state.
+func (w *Watcher) scan() (map[string]*watchedFile, []error) {
+	d := w.dep
+	ret := make(map[string]*watchedFile)
+	var errs []error
+
+	d.mu.RLock()
+	roots := append([]pathRoot(nil), d.roots...)
+	ignore := d.ignoreFilePaths()
+	var loaded []*DepFile
+	for _, filepath := range d.sortedFilePaths() {
+		loaded = append(loaded, d.Files[filepath])
+	}
+
+	// not found imports that can now be found in the include directories
+	for _, df := range loaded {
+		if df.NotFound {
+			inc, inc_file, err := d.findIncludeFile(df.FilePath)
+			if err != nil {
+				errs = append(errs, err)
+			} else if inc_file != "" {
+				ret[df.FilePath] = &watchedFile{source: fileSource{fsys: inc.FS, filename: inc_file}, deptype: DepType_Imported}
+			}
+		}
+	}
+	d.mu.RUnlock()
+
+	// files of the root directories
+	for _, root := range roots {
+		for _, pf := range walkPathFS(ignore, root.currentpath, root.fsys, root.dir) {
+			if pf.dirErr != nil {
+				if !errors.Is(pf.dirErr, fs.ErrNotExist) {
+					errs = append(errs, pf.dirErr)
+					w.keepFiles(ret, pf.filepath)
+				}
+				continue
+			}
+			ret[pf.filepath] = &watchedFile{source: fileSource{fsys: pf.fsys, filename: pf.filename}, deptype: root.deptype}
+		}
+	}
+
+	// files loaded from other locations
+	for _, df := range loaded {
+		if _, ok := ret[df.FilePath]; !ok && df.source != nil {
+			ret[df.FilePath] = &watchedFile{source: *df.source, deptype: df.DepType}
+		}
+	}
+
+	for fp, wf := range ret {
+		if wf.stated {
+			continue
+		}
+		st, err := fs.Stat(wf.source.fsys, wf.source.filename)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				delete(ret, fp)
+				continue
+			}
+			errs = append(errs, err)
+			if prev, ok := w.files[fp]; ok {
+				ret[fp] = prev
+			} else {
+				delete(ret, fp)
+			}
+			continue
+		}
+		wf.modTime = st.ModTime()
+		wf.size = st.Size()
+		wf.stated = true
+	}
+
+	return ret, errs
+}
+
+// Keeps the last known state of the files inside the INTERNAL directory path.
+func (w *Watcher) keepFiles(files map[string]*watchedFile, dir string) {
+	for fp, wf := range w.files {
+		if dir == "" || strings.HasPrefix(fp, dir+"/") {
+			files[fp] = wf
+		}
+	}
+}
+
+// The types reported on the watch events.
+var watchTypeFilter = TypeFilter{Kinds: TypeKind_Message | TypeKind_Enum | TypeKind_Service}
@@ -0,0 +1,132 @@
+package fdep
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDepWatcher(t *testing.T) {
+	modtime := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"app/p_d/d.proto":                     {Data: []byte(testfile_public_d), ModTime: modtime},
+		"app/p_c/c.proto":                     {Data: []byte(testfile_public_c), ModTime: modtime},
+		"app/p_link/link.proto":               {Data: []byte(testfile_link), ModTime: modtime},
+		"include/google/protobuf/empty.proto": {Data: []byte(testfile_google_empty), ModTime: modtime},
+	}
+
+	dep := NewDep()
+	if err := dep.AddIncludeDirFS(fsys, "include"); err != nil {
+		t.Fatalf("Error adding include dir: %v", err)
+	}
+	if err := dep.AddPathFS(fsys, "app", DepType_Own); err != nil {
+		t.Fatalf("Error adding path: %v", err)
+	}
+
+	w, err := NewWatcher(dep)
+	if err != nil {
+		t.Fatalf("Error creating watcher: %v", err)
+	}
+
+	if ev, err := w.Poll(); ev != nil || err != nil {
+		t.Fatalf("Nothing should have changed: %v %v", ev, err)
+	}
+
+	// change d.proto, add b.proto and user.proto, delete link.proto
+	fsys["app/p_d/d.proto"] = &fstest.MapFile{Data: []byte(testfile_public_d + "\nmessage D2 {}\n"), ModTime: modtime.Add(time.Second)}
+	fsys["app/p_b/b.proto"] = &fstest.MapFile{Data: []byte(testfile_public_b), ModTime: modtime}
+	fsys["app/myapp/proto/p_user/user.proto"] = &fstest.MapFile{Data: []byte(testfile_user), ModTime: modtime}
+	delete(fsys, "app/p_link/link.proto")
+
+	ev, err := w.Poll()
+	if err != nil {
+		t.Fatalf("Error polling: %v", err)
+	}
+	if ev == nil {
+		t.Fatalf("Changes should have been detected")
+	}
+
+	if a := strings.Join(ev.Added, ","); a != "myapp/proto/p_user/user.proto,p_b/b.proto" {
+		t.Fatalf("Unexpected added files: %s", a)
+	}
+	if c := strings.Join(ev.Changed, ","); c != "p_d/d.proto" {
+		t.Fatalf("Unexpected changed files: %s", c)
+	}
+	if r := strings.Join(ev.Removed, ","); r != "p_link/link.proto" {
+		t.Fatalf("Unexpected removed files: %s", r)
+	}
+	if a := strings.Join(ev.AffectedFiles, ","); a != "myapp/proto/p_user/user.proto,p_b/b.proto,p_c/c.proto,p_d/d.proto,p_link/link.proto" {
+		t.Fatalf("Unexpected affected files: %s", a)
+	}
+
+	if _, err := dep.GetType("p_d.D2"); err != nil {
+		t.Fatalf("Changed file should have been reloaded: %v", err)
+	}
+	if _, err := dep.GetType("p_user.User"); err != nil {
+		t.Fatalf("Added file should have been loaded: %v", err)
+	}
+	if dep.GetFile("p_link/link.proto") != nil {
+		t.Fatalf("Deleted file should have been removed")
+	}
+}
+
+func TestDepWatcherErrors(t *testing.T) {
+	modtime := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"app/p_d/d.proto": {Data: []byte(testfile_public_d), ModTime: modtime},
+	}
+
+	dep := NewDep()
+	if err := dep.AddPathFS(fsys, "app", DepType_Own); err != nil {
+		t.Fatalf("Error adding path: %v", err)
+	}
+
+	w, err := NewWatcher(dep)
+	if err != nil {
+		t.Fatalf("Error creating watcher: %v", err)
+	}
+
+	// a file that fails to load is only reported once
+	fsys["app/p_invalid/invalid.proto"] = &fstest.MapFile{Data: []byte(testfile_invalid), ModTime: modtime}
+
+	ev, err := w.Poll()
+	if err == nil {
+		t.Fatalf("Loading the invalid file should fail")
+	}
+	if ev == nil || strings.Join(ev.Added, ",") != "p_invalid/invalid.proto" {
+		t.Fatalf("Invalid file should have been reported as added: %v", ev)
+	}
+
+	if ev, err := w.Poll(); ev != nil || err != nil {
+		t.Fatalf("Unchanged invalid file should not be loaded again: %v %v", ev, err)
+	}
+
+	// it is tried again when it changes
+	fsys["app/p_invalid/invalid.proto"] = &fstest.MapFile{Data: []byte(testfile_public_c), ModTime: modtime.Add(time.Second)}
+
+	ev, err = w.Poll()
+	if err != nil {
+		t.Fatalf("Error polling: %v", err)
+	}
+	if ev == nil || strings.Join(ev.Added, ",") != "p_invalid/invalid.proto" {
+		t.Fatalf("Fixed file should have been added: %v", ev)
+	}
+
+	// a deleted root reports its files as removed
+	delete(fsys, "app/p_d/d.proto")
+	delete(fsys, "app/p_invalid/invalid.proto")
+
+	ev, err = w.Poll()
+	if err != nil {
+		t.Fatalf("Error polling: %v", err)
+	}
+	if ev == nil || strings.Join(ev.Removed, ",") != "p_d/d.proto,p_invalid/invalid.proto" {
+		t.Fatalf("Files of the deleted root should have been removed: %v", ev)
+	}
+	if len(dep.GetFiles()) != 0 {
+		t.Fatalf("All files should have been removed")
+	}
+}